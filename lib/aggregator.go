@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Aggregator implements the Reporter interface by aggregating
+// the stats sampled over several collection cycles into
+// statistic sets (min, max, sum and count) that get published
+// to another reporter once every `cycles` flushes.
+//
+// This allows sampling often while publishing less frequently,
+// without losing short spikes.
+type Aggregator struct {
+	reporter Reporter
+	cycles   int
+
+	mu      sync.Mutex
+	flushes int
+	keys    []string
+	series  map[string]*Stat
+}
+
+func NewAggregator(reporter Reporter, cycles int) (aggregator *Aggregator) {
+	if cycles < 1 {
+		cycles = 1
+	}
+
+	aggregator = &Aggregator{
+		reporter: reporter,
+		cycles:   cycles,
+		series:   map[string]*Stat{},
+	}
+	return
+}
+
+// SendStat accounts the stat into the statistic set of its
+// series (identified by name and dimensions).
+func (a *Aggregator) SendStat(stat Stat) (err error) {
+	var key = aggregationKey(stat)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	aggregated, found := a.series[key]
+	if !found {
+		aggregated = &Stat{
+			Name:            stat.Name,
+			Unit:            stat.Unit,
+			ExtraDimensions: stat.ExtraDimensions,
+			Statistics: &StatisticSet{
+				Minimum: stat.Value,
+				Maximum: stat.Value,
+			},
+		}
+
+		a.series[key] = aggregated
+		a.keys = append(a.keys, key)
+	}
+
+	var set = aggregated.Statistics
+	if stat.Value < set.Minimum {
+		set.Minimum = stat.Value
+	}
+	if stat.Value > set.Maximum {
+		set.Maximum = stat.Value
+	}
+
+	set.Sum += stat.Value
+	set.SampleCount++
+
+	aggregated.Value = set.Sum / set.SampleCount
+	aggregated.When = stat.When
+
+	return
+}
+
+// Flush publishes the aggregated stats once every `cycles`
+// calls.
+func (a *Aggregator) Flush() (err error) {
+	a.mu.Lock()
+	a.flushes++
+	var due = a.flushes >= a.cycles
+	a.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	err = a.publish()
+	return
+}
+
+// Close publishes whatever has been aggregated so far and
+// closes the underlying reporter.
+func (a *Aggregator) Close() (err error) {
+	err = a.publish()
+
+	closeErr := a.reporter.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+// publish sends the aggregated stats (in the order their
+// series were first seen) and starts a new aggregation.
+//
+// A stat that fails to be sent doesn't prevent the others
+// from being sent and flushed; the first error is returned.
+func (a *Aggregator) publish() (err error) {
+	a.mu.Lock()
+	var (
+		keys   = a.keys
+		series = a.series
+	)
+
+	a.flushes = 0
+	a.keys = nil
+	a.series = map[string]*Stat{}
+	a.mu.Unlock()
+
+	for _, key := range keys {
+		sendErr := a.reporter.SendStat(*series[key])
+		if sendErr != nil && err == nil {
+			err = sendErr
+		}
+	}
+
+	flushErr := a.reporter.Flush()
+	if err == nil {
+		err = flushErr
+	}
+
+	return
+}
+
+// aggregationKey identifies the series of a stat by its name
+// and dimensions.
+func aggregationKey(stat Stat) string {
+	var dimensions = make([]string, 0, len(stat.ExtraDimensions))
+	for k, v := range stat.ExtraDimensions {
+		dimensions = append(dimensions, k+"="+v)
+	}
+
+	sort.Strings(dimensions)
+	return stat.Name + "|" + strings.Join(dimensions, ",")
+}
@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// rejectingReporter is a fakeReporter that fails to send the
+// stats named in `rejected`.
+type rejectingReporter struct {
+	fakeReporter
+	rejected map[string]bool
+	flushes  int
+	closed   bool
+}
+
+func (r *rejectingReporter) SendStat(stat Stat) (err error) {
+	if r.rejected[stat.Name] {
+		err = errors.Errorf("%s rejected", stat.Name)
+		return
+	}
+
+	err = r.fakeReporter.SendStat(stat)
+	return
+}
+
+func (r *rejectingReporter) Flush() (err error) {
+	r.flushes++
+	err = r.fakeReporter.Flush()
+	return
+}
+
+func (r *rejectingReporter) Close() (err error) {
+	r.closed = true
+	err = r.fakeReporter.Close()
+	return
+}
+
+func TestAggregatorComputesStatistics(t *testing.T) {
+	var (
+		inner      = &rejectingReporter{}
+		aggregator = NewAggregator(inner, 3)
+		when       = time.Unix(1500000000, 0)
+	)
+
+	for idx, value := range []float64{30, 10, 20} {
+		aggregator.SendStat(Stat{
+			Name:  "MemoryUtilization",
+			Value: value,
+			When:  when.Add(time.Duration(idx) * time.Second),
+		})
+		aggregator.SendStat(Stat{
+			Name:            "DiskUtilization",
+			Value:           float64(idx),
+			ExtraDimensions: map[string]string{"Path": "/"},
+		})
+		aggregator.SendStat(Stat{
+			Name:            "DiskUtilization",
+			Value:           50,
+			ExtraDimensions: map[string]string{"Path": "/data"},
+		})
+
+		if err := aggregator.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if published := len(inner.stats); idx < 2 && published != 0 {
+			t.Fatalf("expected nothing to be published after %d cycles, got %d stats", idx+1, published)
+		}
+	}
+
+	if len(inner.stats) != 3 || inner.flushes != 1 {
+		t.Fatalf("expected a single flush of 3 series, got %d flushes of %d stats", inner.flushes, len(inner.stats))
+	}
+
+	for idx, tc := range []struct {
+		desc     string
+		value    float64
+		when     time.Time
+		expected StatisticSet
+	}{
+		{
+			desc:     "memory",
+			value:    20,
+			when:     when.Add(2 * time.Second),
+			expected: StatisticSet{Minimum: 10, Maximum: 30, Sum: 60, SampleCount: 3},
+		},
+		{
+			desc:     "root disk",
+			value:    1,
+			expected: StatisticSet{Minimum: 0, Maximum: 2, Sum: 3, SampleCount: 3},
+		},
+		{
+			desc:     "data disk",
+			value:    50,
+			expected: StatisticSet{Minimum: 50, Maximum: 50, Sum: 150, SampleCount: 3},
+		},
+	} {
+		var stat = inner.stats[idx]
+
+		if stat.Value != tc.value {
+			t.Errorf("%s: expected the average %f, got %f", tc.desc, tc.value, stat.Value)
+		}
+
+		if !stat.When.Equal(tc.when) {
+			t.Errorf("%s: expected the time of the last sample %s, got %s", tc.desc, tc.when, stat.When)
+		}
+
+		if stat.Statistics == nil || !reflect.DeepEqual(*stat.Statistics, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, stat.Statistics)
+		}
+	}
+
+	aggregator.SendStat(Stat{Name: "MemoryUtilization", Value: 5})
+	if err := aggregator.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inner.stats) != 3 {
+		t.Fatal("expected a new aggregation to start after publishing")
+	}
+}
+
+func TestAggregatorPublishesOnClose(t *testing.T) {
+	var (
+		inner      = &rejectingReporter{}
+		aggregator = NewAggregator(inner, 5)
+	)
+
+	aggregator.SendStat(Stat{Name: "LoadAvg1", Value: 1})
+	aggregator.Flush()
+
+	if err := aggregator.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inner.stats) != 1 || !inner.closed {
+		t.Fatalf("expected the pending stats to be published and the reporter closed, got %d stats", len(inner.stats))
+	}
+}
+
+func TestAggregatorKeepsPublishingAfterFailures(t *testing.T) {
+	var (
+		inner = &rejectingReporter{
+			rejected: map[string]bool{"Rejected": true},
+		}
+		aggregator = NewAggregator(inner, 1)
+	)
+
+	for _, name := range []string{"Rejected", "Accepted"} {
+		aggregator.SendStat(Stat{Name: name, Value: 1})
+	}
+
+	if err := aggregator.Flush(); err == nil {
+		t.Fatal("expected the rejected stat to be reported")
+	}
+
+	if len(inner.stats) != 1 || inner.stats[0].Name != "Accepted" || inner.flushes != 1 {
+		t.Fatalf("expected the other stats to be sent and flushed, got %v", inner.stats)
+	}
+
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("expected the failed aggregation to be discarded, got %s", err)
+	}
+}
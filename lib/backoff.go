@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"time"
+)
+
+// Backoff keeps track of when an operation that has been
+// failing should be attempted again, doubling the delay
+// between attempts after each failure.
+type Backoff struct {
+	// Initial is the delay applied after the first failure.
+	Initial time.Duration
+
+	// Max caps the delay between attempts.
+	Max time.Duration
+
+	current time.Duration
+	next    time.Time
+}
+
+// Ready indicates whether an attempt can be made at `now`.
+func (b *Backoff) Ready(now time.Time) bool {
+	return !now.Before(b.next)
+}
+
+// Failure records a failed attempt made at `now`, returning
+// the delay until the next attempt.
+func (b *Backoff) Failure(now time.Time) (delay time.Duration) {
+	if b.current == 0 {
+		b.current = b.Initial
+	} else {
+		b.current *= 2
+	}
+
+	if b.Max > 0 && b.current > b.Max {
+		b.current = b.Max
+	}
+
+	b.next = now.Add(b.current)
+	delay = b.current
+	return
+}
+
+// Success resets the backoff so that the next attempt
+// can be made right away.
+func (b *Backoff) Success() {
+	b.current = 0
+	b.next = time.Time{}
+}
@@ -0,0 +1,333 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cgroupUnlimited is the threshold above which a cgroup v1
+// memory limit is considered to be unset (the kernel reports
+// the maximum page-aligned int64 in that case).
+const cgroupUnlimited = 1 << 60
+
+// CgroupStats holds the counters of a cgroup.
+type CgroupStats struct {
+	Path string
+
+	// MemoryUsage is the working set of the cgroup (its
+	// usage minus the inactive page cache, like `docker
+	// stats` does) and MemoryLimit is 0 when unlimited.
+	MemoryUsage uint64
+	MemoryLimit uint64
+
+	// CPUUsage is the cpu time consumed, in nanoseconds.
+	CPUUsage         uint64
+	Periods          uint64
+	ThrottledPeriods uint64
+
+	When time.Time
+}
+
+// CgroupSample represents the usage of a cgroup between two
+// reads of its counters.
+//
+// CPU is relative to a single core (a cgroup that keeps two
+// cores busy uses 200%) and Throttled is the percentage of
+// enforcement periods in which it got throttled.
+type CgroupSample struct {
+	Container         string
+	MemoryUsage       float64
+	MemoryLimit       float64
+	MemoryUtilization float64
+	CPU               float64
+	Throttled         float64
+	When              time.Time
+}
+
+var (
+	cgroupRoot             = "/sys/fs/cgroup"
+	procSelfCgroupFileName = "/proc/self/cgroup"
+)
+
+// Cgroups gives access to the cgroup filesystem, either
+// v1 (one hierarchy per controller) or v2 (unified).
+//
+// With v1, a cgroup is expected to have the same path in the
+// memory, cpu and cpuacct hierarchies (as docker does).
+type Cgroups struct {
+	V2 bool
+}
+
+// DetectCgroups detects which version of cgroups is mounted.
+func DetectCgroups() (cgroups Cgroups, err error) {
+	_, err = os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err == nil {
+		cgroups.V2 = true
+		return
+	}
+
+	_, err = os.Stat(filepath.Join(cgroupRoot, "memory"))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't find a cgroup v1 or v2 filesystem")
+		return
+	}
+
+	return
+}
+
+// dir returns the directory of a cgroup for a given v1
+// controller (ignored for v2).
+func (c Cgroups) dir(controller, cgroup string) string {
+	if c.V2 {
+		return filepath.Join(cgroupRoot, cgroup)
+	}
+
+	return filepath.Join(cgroupRoot, controller, cgroup)
+}
+
+// Self retrieves the cgroup that awsmon runs in.
+//
+// When running in a container with its own cgroup namespace
+// (or a private cgroup mount), the cgroup listed in
+// /proc/self/cgroup doesn't exist in the filesystem, in which
+// case it's the root one.
+func (c Cgroups) Self() (cgroup string, err error) {
+	data, err := ioutil.ReadFile(procSelfCgroupFileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read cgroup file")
+		return
+	}
+
+	cgroup = "/"
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		if c.V2 && fields[0] == "0" ||
+			!c.V2 && hasController(fields[1], "memory") {
+			cgroup = fields[2]
+			break
+		}
+	}
+
+	if !c.Exists(cgroup) {
+		cgroup = "/"
+	}
+
+	return
+}
+
+// hasController indicates whether a comma-separated list of
+// cgroup v1 controllers contains a given one.
+func hasController(controllers, controller string) bool {
+	for _, candidate := range strings.Split(controllers, ",") {
+		if candidate == controller {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Exists indicates whether a cgroup exists.
+func (c Cgroups) Exists(cgroup string) bool {
+	_, err := os.Stat(c.dir("memory", cgroup))
+	return err == nil
+}
+
+// Children lists the cgroups directly under `parent`.
+func (c Cgroups) Children(parent string) (cgroups []string, err error) {
+	entries, err := ioutil.ReadDir(c.dir("memory", parent))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't list cgroups under %s", parent)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			cgroups = append(cgroups, path.Join(parent, entry.Name()))
+		}
+	}
+
+	return
+}
+
+// ReadStats retrieves the memory and cpu counters of a cgroup.
+func (c Cgroups) ReadStats(cgroup string) (stats CgroupStats, err error) {
+	var (
+		memoryDir = c.dir("memory", cgroup)
+		cpuDir    = c.dir("cpu", cgroup)
+		memory    map[string]uint64
+		cpu       map[string]uint64
+	)
+
+	stats.Path = cgroup
+	stats.When = time.Now()
+
+	if c.V2 && path.Clean(cgroup) == "/" {
+		err = c.readRootStats(&stats)
+		return
+	}
+
+	memory, err = readCgroupKeyValues(filepath.Join(memoryDir, "memory.stat"))
+	if err != nil {
+		return
+	}
+
+	cpu, err = readCgroupKeyValues(filepath.Join(cpuDir, "cpu.stat"))
+	if err != nil {
+		return
+	}
+
+	stats.Periods = cpu["nr_periods"]
+	stats.ThrottledPeriods = cpu["nr_throttled"]
+
+	if c.V2 {
+		stats.MemoryUsage, err = readCgroupValue(filepath.Join(memoryDir, "memory.current"))
+		if err != nil {
+			return
+		}
+
+		stats.MemoryLimit, err = readCgroupValue(filepath.Join(memoryDir, "memory.max"))
+		if err != nil {
+			return
+		}
+
+		stats.MemoryUsage -= minUint64(memory["inactive_file"], stats.MemoryUsage)
+		stats.CPUUsage = cpu["usage_usec"] * 1000
+		return
+	}
+
+	stats.MemoryUsage, err = readCgroupValue(filepath.Join(memoryDir, "memory.usage_in_bytes"))
+	if err != nil {
+		return
+	}
+
+	stats.MemoryLimit, err = readCgroupValue(filepath.Join(memoryDir, "memory.limit_in_bytes"))
+	if err != nil {
+		return
+	}
+
+	if stats.MemoryLimit >= cgroupUnlimited {
+		stats.MemoryLimit = 0
+	}
+
+	stats.MemoryUsage -= minUint64(memory["total_inactive_file"], stats.MemoryUsage)
+	stats.CPUUsage, err = readCgroupValue(
+		filepath.Join(c.dir("cpuacct", cgroup), "cpuacct.usage"))
+	return
+}
+
+// readRootStats retrieves the counters of the root cgroup v2,
+// which has no memory interface files: its memory usage is the
+// one of the whole system (as reported by /proc/meminfo) and
+// it has no limit.
+func (c Cgroups) readRootStats(stats *CgroupStats) (err error) {
+	cpu, err := readCgroupKeyValues(filepath.Join(c.dir("cpu", "/"), "cpu.stat"))
+	if err != nil {
+		return
+	}
+
+	memory, err := TakeMemorySample(MemoryModeAvailable)
+	if err != nil {
+		return
+	}
+
+	stats.MemoryUsage = uint64(memory.Used)
+	stats.CPUUsage = cpu["usage_usec"] * 1000
+	return
+}
+
+// readCgroupValue reads a cgroup file holding a single value,
+// where `max` (unlimited) is read as 0.
+func readCgroupValue(fileName string) (value uint64, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read cgroup file")
+		return
+	}
+
+	var content = strings.TrimSpace(string(data))
+	if content == "max" {
+		return
+	}
+
+	value, err = strconv.ParseUint(content, 10, 64)
+	if err != nil {
+		err = errors.Errorf("could not parse value '%s' of %s: %s",
+			content, fileName, err)
+		return
+	}
+
+	return
+}
+
+// readCgroupKeyValues reads a cgroup file made of `key value`
+// lines (e.g., memory.stat).
+func readCgroupKeyValues(fileName string) (values map[string]uint64, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read cgroup file")
+		return
+	}
+
+	values = make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		values[fields[0]], err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			err = errors.Errorf("could not parse line '%s' of %s: %s",
+				line, fileName, err)
+			return
+		}
+	}
+
+	return
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// TakeCgroupSample computes the usage of a cgroup between the
+// `previous` and the `current` reads of its counters.
+func TakeCgroupSample(previous, current CgroupStats) (sample CgroupSample) {
+	sample.When = current.When
+	sample.MemoryUsage = float64(current.MemoryUsage)
+	sample.MemoryLimit = float64(current.MemoryLimit)
+
+	if current.MemoryLimit > 0 {
+		sample.MemoryUtilization = sample.MemoryUsage / sample.MemoryLimit * 100
+	}
+
+	var seconds = current.When.Sub(previous.When).Seconds()
+	if previous.When.IsZero() || seconds <= 0 {
+		return
+	}
+
+	sample.CPU = float64(delta(previous.CPUUsage, current.CPUUsage)) / 1e9 / seconds * 100
+
+	if periods := delta(previous.Periods, current.Periods); periods > 0 {
+		sample.Throttled = float64(delta(previous.ThrottledPeriods, current.ThrottledPeriods)) /
+			float64(periods) * 100
+	}
+
+	return
+}
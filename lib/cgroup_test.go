@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withCgroupFiles creates a cgroup filesystem made of the
+// given files (relative to its root) for the duration of a
+// test.
+func withCgroupFiles(t *testing.T, files map[string]string) (cleanup func()) {
+	dir, err := ioutil.TempDir("", "awsmon-cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		var path = filepath.Join(dir, name)
+
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	var original = cgroupRoot
+	cgroupRoot = dir
+
+	cleanup = func() {
+		cgroupRoot = original
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func TestCgroupsReadStats(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		v2       bool
+		files    map[string]string
+		expected CgroupStats
+	}{
+		{
+			desc: "v2",
+			v2:   true,
+			files: map[string]string{
+				"cgroup.controllers":       "cpu memory",
+				"app/memory.current":       "104857600\n",
+				"app/memory.max":           "209715200\n",
+				"app/memory.stat":          "anon 52428800\nfile 52428800\ninactive_file 4857600\n",
+				"app/cpu.stat":             "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\nnr_periods 100\nnr_throttled 25\nthrottled_usec 1000\n",
+				"unlimited/memory.current": "1000\n",
+				"unlimited/memory.max":     "max\n",
+				"unlimited/memory.stat":    "inactive_file 2000\n",
+				"unlimited/cpu.stat":       "usage_usec 0\n",
+			},
+			expected: CgroupStats{
+				Path:             "/app",
+				MemoryUsage:      100000000,
+				MemoryLimit:      209715200,
+				CPUUsage:         2500000000,
+				Periods:          100,
+				ThrottledPeriods: 25,
+			},
+		},
+		{
+			desc: "v1",
+			files: map[string]string{
+				"memory/app/memory.usage_in_bytes": "104857600\n",
+				"memory/app/memory.limit_in_bytes": "9223372036854771712\n",
+				"memory/app/memory.stat":           "cache 52428800\ntotal_inactive_file 4857600\n",
+				"cpu/app/cpu.stat":                 "nr_periods 10\nnr_throttled 1\nthrottled_time 1000\n",
+				"cpuacct/app/cpuacct.usage":        "2500000000\n",
+			},
+			expected: CgroupStats{
+				Path:             "/app",
+				MemoryUsage:      100000000,
+				MemoryLimit:      0,
+				CPUUsage:         2500000000,
+				Periods:          10,
+				ThrottledPeriods: 1,
+			},
+		},
+	} {
+		cleanup := withCgroupFiles(t, tc.files)
+
+		cgroups, err := DetectCgroups()
+		if err != nil {
+			cleanup()
+			t.Fatalf("%s: %s", tc.desc, err)
+		}
+
+		if cgroups.V2 != tc.v2 {
+			t.Errorf("%s: expected v2=%t", tc.desc, tc.v2)
+		}
+
+		stats, err := cgroups.ReadStats("/app")
+		stats.When = time.Time{}
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+		} else if stats != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, stats)
+		}
+
+		if cgroups.V2 {
+			stats, err = cgroups.ReadStats("/unlimited")
+			if err != nil || stats.MemoryLimit != 0 || stats.MemoryUsage != 0 {
+				t.Errorf("%s: expected an unlimited cgroup using no memory, got %+v (%v)",
+					tc.desc, stats, err)
+			}
+		}
+
+		cleanup()
+	}
+}
+
+func TestCgroupsReadStatsOfV2Root(t *testing.T) {
+	defer withCgroupFiles(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.stat":           "usage_usec 1000\nuser_usec 800\nsystem_usec 200\n",
+	})()
+
+	stats, err := Cgroups{V2: true}.ReadStats("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.MemoryUsage == 0 || stats.MemoryLimit != 0 || stats.CPUUsage != 1000000 {
+		t.Fatalf("expected the root to use the system memory without a limit, got %+v", stats)
+	}
+}
+
+func TestCgroupsChildren(t *testing.T) {
+	defer withCgroupFiles(t, map[string]string{
+		"cgroup.controllers":            "cpu memory",
+		"docker/a/memory.current":       "1",
+		"docker/b/memory.current":       "1",
+		"docker/cgroup.subtree_control": "cpu memory",
+	})()
+
+	children, err := Cgroups{V2: true}.Children("/docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 2 || children[0] != "/docker/a" || children[1] != "/docker/b" {
+		t.Fatalf("expected /docker/a and /docker/b, got %v", children)
+	}
+}
+
+func TestTakeCgroupSample(t *testing.T) {
+	var (
+		now      = time.Now()
+		previous = CgroupStats{
+			CPUUsage:         1000000000,
+			Periods:          100,
+			ThrottledPeriods: 10,
+			When:             now.Add(-10 * time.Second),
+		}
+		current = CgroupStats{
+			MemoryUsage:      50,
+			MemoryLimit:      200,
+			CPUUsage:         16000000000,
+			Periods:          200,
+			ThrottledPeriods: 35,
+			When:             now,
+		}
+	)
+
+	var sample = TakeCgroupSample(previous, current)
+	if sample.CPU != 150 || sample.Throttled != 25 || sample.MemoryUtilization != 25 {
+		t.Fatalf("expected 150%% cpu, 25%% throttled and 25%% memory, got %+v", sample)
+	}
+
+	sample = TakeCgroupSample(CgroupStats{}, current)
+	if sample.CPU != 0 || sample.Throttled != 0 {
+		t.Fatalf("expected no cpu usage without a previous read, got %+v", sample)
+	}
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Collector is responsible for gathering stats
+// from a given source of metrics.
+type Collector interface {
+
+	// Name identifies the collector (e.g., `disk`).
+	Name() string
+
+	// Collect takes a sample from the source and
+	// converts it into stats ready to be reported.
+	//
+	// A collector that gathers from several places (e.g.,
+	// multiple disks) may return both the stats it could
+	// gather and an error describing the parts that failed.
+	Collect(ctx context.Context) (stats []Stat, err error)
+}
+
+// CollectorFactory instantiates a collector given its raw
+// json configuration. An empty configuration means that the
+// collector should be created with its defaults.
+type CollectorFactory func(cfg json.RawMessage) (collector Collector, err error)
+
+var (
+	collectorFactories = map[string]CollectorFactory{}
+)
+
+// RegisterCollector makes a collector available under a given
+// name so that it can be enabled via configuration.
+//
+// It panics if a collector with the same name has already been
+// registered.
+func RegisterCollector(name string, factory CollectorFactory) {
+	if _, exists := collectorFactories[name]; exists {
+		panic("collector " + name + " already registered")
+	}
+
+	collectorFactories[name] = factory
+}
+
+// CollectorNames lists the names of all the registered
+// collectors in alphabetical order.
+func CollectorNames() (names []string) {
+	names = make([]string, 0, len(collectorFactories))
+	for name := range collectorFactories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// NewCollector instantiates the collector registered under
+// the given name using the raw json configuration provided.
+func NewCollector(name string, cfg json.RawMessage) (collector Collector, err error) {
+	factory, exists := collectorFactories[name]
+	if !exists {
+		err = errors.Errorf("Unknown collector %s", name)
+		return
+	}
+
+	collector, err = factory(cfg)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to create collector %s", name)
+		return
+	}
+
+	return
+}
+
+// decodeCollectorConfig decodes the raw json configuration of a
+// collector into `cfg`, leaving it untouched if there's nothing
+// to decode so that defaults are preserved.
+func decodeCollectorConfig(raw json.RawMessage, cfg interface{}) (err error) {
+	if len(raw) == 0 {
+		return
+	}
+
+	err = json.Unmarshal(raw, cfg)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't decode collector configuration")
+		return
+	}
+
+	return
+}
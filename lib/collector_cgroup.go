@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CgroupCollectorConfig configures the `cgroup` collector.
+type CgroupCollectorConfig struct {
+	// Path is the cgroup to report (e.g., `/docker/<id>`).
+	// It defaults to the cgroup that awsmon runs in, which
+	// is the container's one when running in a container.
+	Path string `json:"path"`
+
+	// Parent makes the collector report every cgroup right
+	// under it instead (e.g., `/docker` for every docker
+	// container), identified by the `Container` dimension.
+	Parent string `json:"parent"`
+}
+
+// CgroupCollector gathers memory and cpu stats from the cgroup
+// filesystem (v1 or v2).
+type CgroupCollector struct {
+	cfg      CgroupCollectorConfig
+	cgroups  Cgroups
+	previous map[string]CgroupStats
+}
+
+func init() {
+	RegisterCollector("cgroup", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = CgroupCollectorConfig{}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewCgroupCollector(cfg)
+		return
+	})
+}
+
+// NewCgroupCollector creates a cgroup collector, detecting the
+// version of cgroups in use and taking an initial read of the
+// counters so that the first collection already has something
+// to compare against.
+func NewCgroupCollector(cfg CgroupCollectorConfig) (collector *CgroupCollector, err error) {
+	if cfg.Path != "" && cfg.Parent != "" {
+		err = errors.Errorf("only one of path and parent can be set")
+		return
+	}
+
+	cgroups, err := DetectCgroups()
+	if err != nil {
+		return
+	}
+
+	if cfg.Path == "" && cfg.Parent == "" {
+		cfg.Path, err = cgroups.Self()
+		if err != nil {
+			return
+		}
+	}
+
+	collector = &CgroupCollector{
+		cfg:      cfg,
+		cgroups:  cgroups,
+		previous: make(map[string]CgroupStats),
+	}
+
+	_, err = collector.Collect(context.Background())
+	return
+}
+
+func (c *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Collect takes a sample of each of the cgroups, covering the
+// time since the last collection. Cgroups that disappear in
+// the meantime (e.g., stopped containers) are skipped.
+func (c *CgroupCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	var cgroups = []string{c.cfg.Path}
+	if c.cfg.Parent != "" {
+		cgroups, err = c.cgroups.Children(c.cfg.Parent)
+		if err != nil {
+			return
+		}
+	}
+
+	var (
+		current  = make(map[string]CgroupStats, len(cgroups))
+		failures []string
+	)
+
+	for _, cgroup := range cgroups {
+		counters, readErr := c.cgroups.ReadStats(cgroup)
+		if readErr != nil {
+			if c.cfg.Parent == "" || c.cgroups.Exists(cgroup) {
+				failures = append(failures, errors.Wrapf(readErr,
+					"cgroup %s", cgroup).Error())
+			}
+			continue
+		}
+
+		current[cgroup] = counters
+
+		previous, found := c.previous[cgroup]
+		var sample = TakeCgroupSample(previous, counters)
+		if c.cfg.Parent != "" {
+			sample.Container = path.Base(cgroup)
+		}
+
+		stats = append(stats, NewContainerMemoryUsageStat(&sample))
+
+		// cpu usage is only known from the second read on.
+		if found {
+			stats = append(stats,
+				NewContainerCPUUtilizationStat(&sample),
+				NewContainerCPUThrottledStat(&sample))
+		}
+
+		if sample.MemoryLimit > 0 {
+			stats = append(stats,
+				NewContainerMemoryLimitStat(&sample),
+				NewContainerMemoryUtilizationStat(&sample))
+		}
+	}
+
+	c.previous = current
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to sample %d cgroups: %s",
+			len(failures), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
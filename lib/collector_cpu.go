@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// CPUCollectorConfig configures the `cpu` collector.
+type CPUCollectorConfig struct {
+	// PerCore adds a per-core breakdown of the stats,
+	// identified by the `Core` dimension.
+	PerCore bool `json:"per-core"`
+}
+
+// CPUCollector gathers cpu utilization stats from the
+// difference between consecutive reads of /proc/stat.
+type CPUCollector struct {
+	cfg      CPUCollectorConfig
+	previous map[string]CPUTimes
+}
+
+func init() {
+	RegisterCollector("cpu", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = CPUCollectorConfig{}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewCPUCollector(cfg)
+		return
+	})
+}
+
+// NewCPUCollector creates a cpu collector, taking an initial
+// read of the cpu times so that the first collection already
+// has something to compare against.
+func NewCPUCollector(cfg CPUCollectorConfig) (collector *CPUCollector, err error) {
+	previous, err := ReadCPUTimes()
+	if err != nil {
+		return
+	}
+
+	collector = &CPUCollector{
+		cfg:      cfg,
+		previous: previous,
+	}
+	return
+}
+
+func (c *CPUCollector) Name() string {
+	return "cpu"
+}
+
+// Collect takes a cpu sample covering the time since the
+// last collection.
+func (c *CPUCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	sample, current, err := TakeCPUSample(c.previous, c.cfg.PerCore)
+	if err != nil {
+		return
+	}
+
+	c.previous = current
+
+	stats = append(stats, newCPUStats(&sample)...)
+	for idx := range sample.Cores {
+		stats = append(stats, newCPUStats(&sample.Cores[idx])...)
+	}
+
+	return
+}
+
+// newCPUStats generates all the stats of a cpu sample.
+func newCPUStats(sample *CPUSample) []Stat {
+	return []Stat{
+		NewCPUUtilizationStat(sample),
+		NewCPUUserStat(sample),
+		NewCPUSystemStat(sample),
+		NewCPUIOWaitStat(sample),
+		NewCPUStealStat(sample),
+		NewCPUIdleStat(sample),
+	}
+}
@@ -0,0 +1,216 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DiskCollectorConfig configures the `disk` collector.
+type DiskCollectorConfig struct {
+	// Paths lists the mount points to sample.
+	Paths []string `json:"paths"`
+
+	// AutoDiscover samples every mounted filesystem whose
+	// type is not listed in ExcludeFsTypes in addition to
+	// Paths. Mounts are discovered on every collection.
+	AutoDiscover   bool     `json:"auto-discover"`
+	ExcludeFsTypes []string `json:"exclude-fs-types,omitempty"`
+
+	// Inodes also reports the percentage of inodes used.
+	Inodes bool `json:"inodes"`
+
+	// Bytes also reports the total, used and free space
+	// in bytes.
+	Bytes bool `json:"bytes"`
+
+	// Timeout bounds the `statfs` call of each path so that
+	// an unresponsive filesystem (e.g., a lost NFS server)
+	// doesn't stall the collection.
+	Timeout time.Duration `json:"timeout"`
+}
+
+// defaultExcludeFsTypes lists the types of the pseudo and
+// in-memory filesystems that are not worth reporting, as
+// well as the network ones, which can hang `statfs` and are
+// better monitored on their servers.
+var defaultExcludeFsTypes = []string{
+	"autofs", "binfmt_misc", "bpf", "ceph", "cgroup", "cgroup2",
+	"cifs", "configfs", "debugfs", "devpts", "devtmpfs",
+	"efivarfs", "fuse.lxcfs", "fuse.sshfs", "fusectl",
+	"glusterfs", "hugetlbfs", "mqueue", "nfs", "nfs4", "nsfs",
+	"overlay", "proc", "pstore", "ramfs", "rpc_pipefs",
+	"securityfs", "selinuxfs", "smb3", "smbfs", "squashfs",
+	"sysfs", "tmpfs", "tracefs",
+}
+
+// defaultDiskTimeout is the default timeout of the `statfs`
+// call of each path.
+const defaultDiskTimeout = 5 * time.Second
+
+// takeDiskSample samples a path (replaced in tests).
+var takeDiskSample = TakeDiskSample
+
+// DiskCollector gathers disk utilization stats
+// from a list of mounted filesystems.
+type DiskCollector struct {
+	cfg DiskCollectorConfig
+
+	// pending holds the paths whose `statfs` hasn't
+	// returned yet.
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func init() {
+	RegisterCollector("disk", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = DiskCollectorConfig{
+			Paths:          []string{"/"},
+			ExcludeFsTypes: defaultExcludeFsTypes,
+			Inodes:         true,
+			Timeout:        defaultDiskTimeout,
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector = NewDiskCollector(cfg)
+		return
+	})
+}
+
+func NewDiskCollector(cfg DiskCollectorConfig) (collector *DiskCollector) {
+	collector = &DiskCollector{
+		cfg:     cfg,
+		pending: make(map[string]bool),
+	}
+	return
+}
+
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+// Collect takes a disk sample for each of the configured
+// paths (and discovered mounts).
+//
+// A path that can't be sampled doesn't prevent the others
+// from being reported.
+func (c *DiskCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	paths, err := c.paths()
+	if err != nil {
+		return
+	}
+
+	var failures []string
+	for _, path := range paths {
+		sample, sampleErr := c.sample(ctx, path)
+		if sampleErr != nil {
+			failures = append(failures, sampleErr.Error())
+			continue
+		}
+
+		stats = append(stats, NewDiskUtilizationStat(&sample))
+		if c.cfg.Inodes {
+			stats = append(stats, NewInodesUtilizationStat(&sample))
+		}
+
+		if c.cfg.Bytes {
+			stats = append(stats,
+				NewDiskTotalStat(&sample),
+				NewDiskUsedStat(&sample),
+				NewDiskFreeStat(&sample))
+		}
+	}
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to sample %d out of %d disks: %s",
+			len(failures), len(paths), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
+
+// paths lists the paths to sample: the configured ones
+// followed by the mount points discovered (if enabled)
+// that are not configured already.
+func (c *DiskCollector) paths() (paths []string, err error) {
+	if !c.cfg.AutoDiscover {
+		paths = c.cfg.Paths
+		return
+	}
+
+	mounts, err := ReadMountInfo()
+	if err != nil {
+		return
+	}
+
+	var seen = make(map[string]bool)
+	for _, path := range c.cfg.Paths {
+		seen[path] = true
+		paths = append(paths, path)
+	}
+
+	for _, mount := range DiscoverMounts(mounts, c.cfg.ExcludeFsTypes) {
+		if !seen[mount.MountPoint] {
+			seen[mount.MountPoint] = true
+			paths = append(paths, mount.MountPoint)
+		}
+	}
+
+	return
+}
+
+// sample takes a disk sample of a path, giving up once the
+// timeout elapses or the context is done.
+//
+// As `statfs` can't be interrupted, a call that times out is
+// left running and the path is skipped until it returns.
+func (c *DiskCollector) sample(ctx context.Context, path string) (sample DiskSample, err error) {
+	c.mu.Lock()
+	if c.pending[path] {
+		c.mu.Unlock()
+		err = errors.Errorf("Still waiting on FS info for path %s", path)
+		return
+	}
+	c.pending[path] = true
+	c.mu.Unlock()
+
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		sample DiskSample
+		err    error
+	}
+
+	var done = make(chan result, 1)
+	go func() {
+		sample, err := takeDiskSample(path)
+
+		c.mu.Lock()
+		delete(c.pending, path)
+		c.mu.Unlock()
+
+		done <- result{sample, err}
+	}()
+
+	select {
+	case res := <-done:
+		sample, err = res.sample, res.err
+	case <-ctx.Done():
+		err = errors.Errorf("Timed out retrieving FS info for path %s", path)
+	}
+
+	return
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskCollectorTimesOutHungFilesystems(t *testing.T) {
+	var release = make(chan struct{})
+	defer func() {
+		takeDiskSample = TakeDiskSample
+	}()
+	takeDiskSample = func(path string) (sample DiskSample, err error) {
+		if path == "/mnt/nfs" {
+			<-release
+		}
+
+		sample = DiskSample{Path: path, DiskUtilization: 50}
+		return
+	}
+
+	collector := NewDiskCollector(DiskCollectorConfig{
+		Paths:   []string{"/", "/mnt/nfs"},
+		Timeout: 50 * time.Millisecond,
+	})
+
+	for _, expected := range []string{"Timed out", "Still waiting"} {
+		stats, err := collector.Collect(context.Background())
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected '%s' for the hung filesystem, got %v", expected, err)
+		}
+
+		if len(stats) != 1 || stats[0].ExtraDimensions["Path"] != "/" {
+			t.Fatalf("expected / to be reported, got %+v", stats)
+		}
+	}
+
+	close(release)
+
+	var deadline = time.Now().Add(5 * time.Second)
+	for {
+		stats, err := collector.Collect(context.Background())
+		if err == nil {
+			if len(stats) != 2 {
+				t.Fatalf("expected both paths to be reported, got %+v", stats)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the filesystem to recover, got %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDefaultExcludeFsTypesSkipsNetworkFilesystems(t *testing.T) {
+	var excluded = make(map[string]bool)
+	for _, fsType := range defaultExcludeFsTypes {
+		excluded[fsType] = true
+	}
+
+	for _, fsType := range []string{"nfs", "nfs4", "cifs", "fuse.sshfs"} {
+		if !excluded[fsType] {
+			t.Errorf("expected %s to be excluded by default", fsType)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DiskIOCollectorConfig configures the `diskio` collector.
+type DiskIOCollectorConfig struct {
+	// Paths lists the mount points whose backing block
+	// devices should be sampled.
+	Paths []string `json:"paths"`
+}
+
+// DiskIOCollector gathers io throughput and latency stats of
+// the block devices backing a list of mounted filesystems
+// from the difference between consecutive reads of
+// /proc/diskstats.
+type DiskIOCollector struct {
+	cfg      DiskIOCollectorConfig
+	previous DiskIOSnapshot
+}
+
+func init() {
+	RegisterCollector("diskio", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = DiskIOCollectorConfig{
+			Paths: []string{"/"},
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewDiskIOCollector(cfg)
+		return
+	})
+}
+
+// NewDiskIOCollector creates a diskio collector, taking an
+// initial snapshot so that the first collection already has
+// something to compare against.
+func NewDiskIOCollector(cfg DiskIOCollectorConfig) (collector *DiskIOCollector, err error) {
+	previous, err := ReadDiskIOSnapshot()
+	if err != nil {
+		return
+	}
+
+	collector = &DiskIOCollector{
+		cfg:      cfg,
+		previous: previous,
+	}
+	return
+}
+
+func (c *DiskIOCollector) Name() string {
+	return "diskio"
+}
+
+// Collect takes a diskio sample for each of the configured
+// paths covering the time since the last collection.
+func (c *DiskIOCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	current, err := ReadDiskIOSnapshot()
+	if err != nil {
+		return
+	}
+
+	mounts, err := ReadMountInfo()
+	if err != nil {
+		return
+	}
+
+	var failures []string
+	for _, path := range c.cfg.Paths {
+		sample, sampleErr := TakeDiskIOSample(path, mounts, c.previous, current)
+		if sampleErr != nil {
+			failures = append(failures, sampleErr.Error())
+			continue
+		}
+
+		// devices that just showed up are reported from
+		// the next collection on.
+		if sample.Elapsed == 0 {
+			continue
+		}
+
+		stats = append(stats,
+			NewDiskReadBytesStat(&sample),
+			NewDiskWriteBytesStat(&sample),
+			NewDiskReadOpsStat(&sample),
+			NewDiskWriteOpsStat(&sample),
+			NewDiskQueueDepthStat(&sample),
+			NewDiskAwaitStat(&sample))
+	}
+
+	c.previous = current
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to sample io of %d out of %d disks: %s",
+			len(failures), len(c.cfg.Paths), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
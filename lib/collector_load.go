@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// LoadCollectorConfig configures the `load` collector.
+type LoadCollectorConfig struct {
+	// Relativize makes the load averages relative
+	// to the number of cpus.
+	Relativize bool `json:"relativize"`
+
+	Load1M  bool `json:"load-1m"`
+	Load5M  bool `json:"load-5m"`
+	Load15M bool `json:"load-15m"`
+}
+
+// LoadCollector gathers load average stats.
+type LoadCollector struct {
+	cfg LoadCollectorConfig
+}
+
+func init() {
+	RegisterCollector("load", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = LoadCollectorConfig{
+			Relativize: true,
+			Load1M:     true,
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector = NewLoadCollector(cfg)
+		return
+	})
+}
+
+func NewLoadCollector(cfg LoadCollectorConfig) (collector *LoadCollector) {
+	collector = &LoadCollector{
+		cfg: cfg,
+	}
+	return
+}
+
+func (c *LoadCollector) Name() string {
+	return "load"
+}
+
+// Collect takes a load sample and generates a stat for
+// each of the load averages enabled.
+func (c *LoadCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	sample, err := TakeLoadSample(c.cfg.Relativize)
+	if err != nil {
+		return
+	}
+
+	if c.cfg.Load1M {
+		stats = append(stats, NewLoadAvg1Stat(&sample))
+	}
+
+	if c.cfg.Load5M {
+		stats = append(stats, NewLoadAvg5Stat(&sample))
+	}
+
+	if c.cfg.Load15M {
+		stats = append(stats, NewLoadAvg15Stat(&sample))
+	}
+
+	return
+}
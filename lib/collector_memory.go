@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// MemoryCollectorConfig configures the `memory` collector.
+type MemoryCollectorConfig struct {
+	// Mode determines how the memory in use is calculated
+	// (`available` or `legacy`).
+	Mode MemoryMode `json:"mode"`
+
+	// Swap also reports the percentage of swap used.
+	Swap bool `json:"swap"`
+
+	// Bytes also reports the total, used, available,
+	// buffers and cached memory in bytes.
+	Bytes bool `json:"bytes"`
+}
+
+// MemoryCollector gathers memory utilization stats.
+type MemoryCollector struct {
+	cfg    MemoryCollectorConfig
+	warned bool
+}
+
+func init() {
+	RegisterCollector("memory", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = MemoryCollectorConfig{
+			Mode: MemoryModeAvailable,
+			Swap: true,
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewMemoryCollector(cfg)
+		return
+	})
+}
+
+func NewMemoryCollector(cfg MemoryCollectorConfig) (collector *MemoryCollector, err error) {
+	switch cfg.Mode {
+	case MemoryModeAvailable, MemoryModeLegacy:
+	default:
+		err = errors.Errorf("unknown memory mode '%s'", cfg.Mode)
+		return
+	}
+
+	collector = &MemoryCollector{
+		cfg: cfg,
+	}
+	return
+}
+
+func (c *MemoryCollector) Name() string {
+	return "memory"
+}
+
+// Collect takes a memory sample.
+func (c *MemoryCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	sample, err := TakeMemorySample(c.cfg.Mode)
+	if err != nil {
+		return
+	}
+
+	if sample.Mode != c.cfg.Mode && !c.warned {
+		log.Warn().
+			Str("from", "collector_memory").
+			Str("mode", string(c.cfg.Mode)).
+			Msg("MemAvailable not reported by the kernel, falling back to the legacy mode")
+		c.warned = true
+	}
+
+	stats = append(stats, NewMemoryUtilizationStat(&sample))
+	if c.cfg.Swap {
+		stats = append(stats, NewSwapUtilizationStat(&sample))
+	}
+
+	if c.cfg.Bytes {
+		stats = append(stats,
+			NewMemoryTotalStat(&sample),
+			NewMemoryUsedStat(&sample),
+			NewMemoryAvailableStat(&sample),
+			NewMemoryBuffersStat(&sample),
+			NewMemoryCachedStat(&sample))
+	}
+
+	return
+}
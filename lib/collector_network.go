@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NetworkCollectorConfig configures the `network` collector.
+type NetworkCollectorConfig struct {
+	// Include lists glob patterns of the interfaces to
+	// sample. When empty, all interfaces are sampled.
+	Include []string `json:"include"`
+
+	// Exclude lists glob patterns of the interfaces to
+	// skip. Exclusions take precedence over inclusions.
+	Exclude []string `json:"exclude"`
+}
+
+// NetworkCollector gathers per-interface traffic stats from
+// the difference between consecutive reads of /proc/net/dev.
+type NetworkCollector struct {
+	cfg      NetworkCollectorConfig
+	previous NetworkSnapshot
+}
+
+func init() {
+	RegisterCollector("network", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = NetworkCollectorConfig{
+			Exclude: []string{"lo", "docker*", "veth*"},
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewNetworkCollector(cfg)
+		return
+	})
+}
+
+// NewNetworkCollector creates a network collector, taking an
+// initial snapshot so that the first collection already has
+// something to compare against.
+func NewNetworkCollector(cfg NetworkCollectorConfig) (collector *NetworkCollector, err error) {
+	for _, pattern := range append(cfg.Include, cfg.Exclude...) {
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			err = errors.Wrapf(err, "invalid interface pattern '%s'", pattern)
+			return
+		}
+	}
+
+	previous, err := ReadNetworkSnapshot()
+	if err != nil {
+		return
+	}
+
+	collector = &NetworkCollector{
+		cfg:      cfg,
+		previous: previous,
+	}
+	return
+}
+
+func (c *NetworkCollector) Name() string {
+	return "network"
+}
+
+// Collect takes a network sample of each of the interfaces
+// that match the configured patterns, covering the time since
+// the last collection.
+func (c *NetworkCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	current, err := ReadNetworkSnapshot()
+	if err != nil {
+		return
+	}
+
+	var failures []string
+	for _, iface := range current.Interfaces {
+		if !c.matches(iface.Interface) {
+			continue
+		}
+
+		sample, sampleErr := TakeNetworkSample(iface.Interface, c.previous, current)
+		if sampleErr != nil {
+			failures = append(failures, sampleErr.Error())
+			continue
+		}
+
+		// interfaces that just showed up are reported from
+		// the next collection on.
+		if sample.Elapsed == 0 {
+			continue
+		}
+
+		stats = append(stats,
+			NewNetworkBytesInStat(&sample),
+			NewNetworkBytesOutStat(&sample),
+			NewNetworkPacketsInStat(&sample),
+			NewNetworkPacketsOutStat(&sample),
+			NewNetworkErrorsInStat(&sample),
+			NewNetworkErrorsOutStat(&sample),
+			NewNetworkDropsInStat(&sample),
+			NewNetworkDropsOutStat(&sample))
+	}
+
+	c.previous = current
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to sample %d interfaces: %s",
+			len(failures), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
+
+// matches indicates whether an interface should be sampled
+// according to the include and exclude patterns.
+func (c *NetworkCollector) matches(name string) bool {
+	for _, pattern := range c.cfg.Exclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+
+	if len(c.cfg.Include) == 0 {
+		return true
+	}
+
+	for _, pattern := range c.cfg.Include {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
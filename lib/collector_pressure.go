@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// PressureCollectorConfig configures the `pressure` collector.
+type PressureCollectorConfig struct {
+	// Resources lists the resources to report the pressure
+	// of (`cpu`, `memory` and `io`).
+	Resources []string `json:"resources"`
+}
+
+// PressureCollector gathers pressure stall information (PSI)
+// from the difference between consecutive reads of the files
+// under /proc/pressure.
+type PressureCollector struct {
+	resources []string
+	previous  map[string]PressureStats
+}
+
+func init() {
+	RegisterCollector("pressure", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = PressureCollectorConfig{
+			Resources: []string{"cpu", "memory", "io"},
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewPressureCollector(cfg)
+		return
+	})
+}
+
+// NewPressureCollector creates a pressure collector, taking an
+// initial read of the stall times so that the first collection
+// already has something to compare against.
+//
+// On kernels without /proc/pressure (older than 4.20 or built
+// without PSI), the collector reports nothing. Resources whose
+// pressure can't be read otherwise (e.g., PSI disabled at boot)
+// are skipped with a warning.
+func NewPressureCollector(cfg PressureCollectorConfig) (collector *PressureCollector, err error) {
+	collector = &PressureCollector{
+		previous: make(map[string]PressureStats),
+	}
+
+	for _, resource := range cfg.Resources {
+		switch resource {
+		case "cpu", "memory", "io":
+		default:
+			err = errors.Errorf("unknown pressure resource '%s'", resource)
+			return
+		}
+	}
+
+	if _, statErr := os.Stat(pressureDirectory); os.IsNotExist(statErr) {
+		log.Info().
+			Str("from", "collector_pressure").
+			Msg("pressure stall information not supported by the kernel")
+		return
+	}
+
+	for _, resource := range cfg.Resources {
+		stats, readErr := ReadPressureStats(resource)
+		if readErr != nil {
+			log.Warn().
+				Str("from", "collector_pressure").
+				Err(readErr).
+				Str("resource", resource).
+				Msg("pressure stall information not supported")
+			continue
+		}
+
+		collector.resources = append(collector.resources, resource)
+		collector.previous[resource] = stats
+	}
+
+	return
+}
+
+func (c *PressureCollector) Name() string {
+	return "pressure"
+}
+
+// Collect takes a pressure sample of each of the resources,
+// covering the time since the last collection.
+func (c *PressureCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	var failures []string
+
+	for _, resource := range c.resources {
+		current, readErr := ReadPressureStats(resource)
+		if readErr != nil {
+			failures = append(failures, readErr.Error())
+			continue
+		}
+
+		var sample = TakePressureSample(c.previous[resource], current)
+		c.previous[resource] = current
+
+		stats = append(stats, NewPressureSomeStat(&sample))
+		if sample.HasFull {
+			stats = append(stats, NewPressureFullStat(&sample))
+		}
+	}
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to sample %d resources: %s",
+			len(failures), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
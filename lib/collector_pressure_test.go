@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPressureCollectorWithoutPSI(t *testing.T) {
+	var original = pressureDirectory
+	defer func() {
+		pressureDirectory = original
+	}()
+	pressureDirectory = filepath.Join(os.TempDir(), "awsmon-missing-pressure")
+
+	collector, err := NewPressureCollector(PressureCollectorConfig{
+		Resources: []string{"cpu", "memory", "io"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := collector.Collect(context.Background())
+	if err != nil || len(stats) != 0 {
+		t.Fatalf("expected nothing to be reported, got %+v (%v)", stats, err)
+	}
+}
+
+func TestPressureCollectorSkipsUnreadableResources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-pressure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var original = pressureDirectory
+	defer func() {
+		pressureDirectory = original
+	}()
+	pressureDirectory = dir
+
+	err = ioutil.WriteFile(filepath.Join(dir, "memory"), []byte(
+		"some avg10=0.00 avg60=0.00 avg300=0.00 total=100\n"+
+			"full avg10=0.00 avg60=0.00 avg300=0.00 total=50\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector, err := NewPressureCollector(PressureCollectorConfig{
+		Resources: []string{"cpu", "memory"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 2 || stats[0].ExtraDimensions["Resource"] != "memory" {
+		t.Fatalf("expected the memory pressure to be reported, got %+v", stats)
+	}
+}
+
+func TestNewPressureCollectorRejectsUnknownResources(t *testing.T) {
+	_, err := NewPressureCollector(PressureCollectorConfig{
+		Resources: []string{"network"},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,248 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxProcessCommLength is the number of characters of the
+// name of a process that the kernel keeps.
+const maxProcessCommLength = 15
+
+// ProcessMatcher identifies the processes that a check looks
+// for. Exactly one of Comm, Cmdline and Pidfile must be set.
+type ProcessMatcher struct {
+	// Name identifies the matcher in the `Matcher`
+	// dimension of the stats.
+	Name string `json:"name"`
+
+	// Comm matches processes by their exact name as in
+	// /proc/<pid>/comm, which the kernel truncates to 15
+	// characters (longer names are rejected as they would
+	// never match).
+	Comm string `json:"comm"`
+
+	// Cmdline matches processes whose command line (with
+	// arguments separated by spaces) matches a regular
+	// expression.
+	Cmdline string `json:"cmdline"`
+
+	// Pidfile matches the process whose pid is written
+	// to a file.
+	Pidfile string `json:"pidfile"`
+}
+
+// ProcessChecksCollectorConfig configures the `process-checks`
+// collector.
+type ProcessChecksCollectorConfig struct {
+	Matchers []ProcessMatcher `json:"matchers"`
+}
+
+// ProcessCheckSample represents the number of processes that
+// matched a given matcher.
+type ProcessCheckSample struct {
+	Matcher string
+	Count   float64
+	When    time.Time
+}
+
+// ProcessChecksCollector checks whether the processes of each
+// of the configured matchers are running.
+type ProcessChecksCollector struct {
+	matchers []ProcessMatcher
+	cmdlines []*regexp.Regexp
+}
+
+func init() {
+	RegisterCollector("process-checks", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = ProcessChecksCollectorConfig{}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewProcessChecksCollector(cfg)
+		return
+	})
+}
+
+// NewProcessChecksCollector creates a process-checks collector
+// after validating its matchers.
+func NewProcessChecksCollector(cfg ProcessChecksCollectorConfig) (collector *ProcessChecksCollector, err error) {
+	if len(cfg.Matchers) == 0 {
+		err = errors.Errorf("at least one process matcher must be configured")
+		return
+	}
+
+	collector = &ProcessChecksCollector{
+		matchers: cfg.Matchers,
+		cmdlines: make([]*regexp.Regexp, len(cfg.Matchers)),
+	}
+
+	var names = make(map[string]bool, len(cfg.Matchers))
+	for idx, matcher := range cfg.Matchers {
+		if matcher.Name == "" {
+			err = errors.Errorf("process matcher %d has no name", idx)
+			return
+		}
+
+		if names[matcher.Name] {
+			err = errors.Errorf("process matcher '%s' is defined more than once", matcher.Name)
+			return
+		}
+		names[matcher.Name] = true
+
+		var criteria = 0
+		for _, criterion := range []string{matcher.Comm, matcher.Cmdline, matcher.Pidfile} {
+			if criterion != "" {
+				criteria++
+			}
+		}
+
+		if criteria != 1 {
+			err = errors.Errorf(
+				"process matcher '%s' must set exactly one of comm, cmdline and pidfile",
+				matcher.Name)
+			return
+		}
+
+		if len(matcher.Comm) > maxProcessCommLength {
+			err = errors.Errorf(
+				"comm of process matcher '%s' is longer than %d characters and would never match (truncated, it'd be '%s')",
+				matcher.Name, maxProcessCommLength, matcher.Comm[:maxProcessCommLength])
+			return
+		}
+
+		if matcher.Cmdline != "" {
+			collector.cmdlines[idx], err = regexp.Compile(matcher.Cmdline)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"invalid cmdline expression of process matcher '%s'", matcher.Name)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (c *ProcessChecksCollector) Name() string {
+	return "process-checks"
+}
+
+// Collect counts the running processes that match each of the
+// matchers. Zombie processes are not considered to be running
+// and awsmon itself is never matched (like pgrep does).
+func (c *ProcessChecksCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	snapshot, err := ReadProcessSnapshot()
+	if err != nil {
+		return
+	}
+
+	var (
+		counts   = make([]float64, len(c.matchers))
+		self     = os.Getpid()
+		failures []string
+	)
+
+	for _, process := range snapshot.Processes {
+		if process.State == "Z" || process.Pid == self {
+			continue
+		}
+
+		var (
+			cmdline       string
+			cmdlineLoaded bool
+		)
+
+		for idx, matcher := range c.matchers {
+			switch {
+			case matcher.Comm != "":
+				if process.Name == matcher.Comm {
+					counts[idx]++
+				}
+			case c.cmdlines[idx] != nil:
+				if !cmdlineLoaded {
+					// the process may have exited in the meantime,
+					// in which case it just doesn't match.
+					cmdline, _ = ReadProcessCmdline(process.Pid)
+					cmdlineLoaded = true
+				}
+
+				if cmdline != "" && c.cmdlines[idx].MatchString(cmdline) {
+					counts[idx]++
+				}
+			}
+		}
+	}
+
+	for idx, matcher := range c.matchers {
+		if matcher.Pidfile == "" {
+			continue
+		}
+
+		running, checkErr := checkPidfile(matcher.Pidfile)
+		if checkErr != nil {
+			failures = append(failures, checkErr.Error())
+		}
+
+		if running {
+			counts[idx] = 1
+		}
+	}
+
+	for idx, matcher := range c.matchers {
+		var sample = ProcessCheckSample{
+			Matcher: matcher.Name,
+			Count:   counts[idx],
+			When:    snapshot.When,
+		}
+
+		stats = append(stats,
+			NewProcessCountStat(&sample),
+			NewProcessUpStat(&sample))
+	}
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to check %d pidfiles: %s",
+			len(failures), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
+
+// checkPidfile indicates whether the process whose pid is
+// written to a pidfile is running. A missing pidfile means
+// that the process is not running.
+func checkPidfile(pidfile string) (running bool, err error) {
+	data, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err, "couldn't read pidfile %s", pidfile)
+		return
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		err = errors.Errorf("could not parse pid of pidfile %s: %s", pidfile, err)
+		return
+	}
+
+	process, statsErr := ReadProcessStats(pid)
+	running = statsErr == nil && process.State != "Z"
+	return
+}
@@ -0,0 +1,231 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeProcessFixture fakes a process under `dir` (standing
+// for /proc) with the given name, state and arguments.
+func writeProcessFixture(t *testing.T, dir string, pid int, name, state string, args ...string) {
+	var processDir = filepath.Join(dir, strconv.Itoa(pid))
+	if err := os.MkdirAll(processDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, content := range map[string]string{
+		"stat": fmt.Sprintf(
+			"%d (%s) %s 1 %d %d 0 -1 4194624 1000 0 0 0 150 50 0 0 20 0 1 0 98765 123456789 2048 18446744073709551615\n",
+			pid, name, state, pid, pid),
+		"status":  "Threads:\t1\nVmRSS:\t1024 kB\n",
+		"cmdline": strings.Join(args, "\x00") + "\x00",
+	} {
+		err := ioutil.WriteFile(filepath.Join(processDir, file), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewProcessChecksCollectorValidatesMatchers(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		matchers []ProcessMatcher
+		valid    bool
+	}{
+		{
+			desc: "no matchers",
+		},
+		{
+			desc:     "no name",
+			matchers: []ProcessMatcher{{Comm: "nginx"}},
+		},
+		{
+			desc: "duplicated name",
+			matchers: []ProcessMatcher{
+				{Name: "web", Comm: "nginx"},
+				{Name: "web", Comm: "apache2"},
+			},
+		},
+		{
+			desc:     "no criterion",
+			matchers: []ProcessMatcher{{Name: "web"}},
+		},
+		{
+			desc:     "comm and cmdline",
+			matchers: []ProcessMatcher{{Name: "web", Comm: "nginx", Cmdline: "nginx"}},
+		},
+		{
+			desc:     "cmdline and pidfile",
+			matchers: []ProcessMatcher{{Name: "web", Cmdline: "nginx", Pidfile: "/run/nginx.pid"}},
+		},
+		{
+			desc:     "invalid cmdline expression",
+			matchers: []ProcessMatcher{{Name: "web", Cmdline: "nginx("}},
+		},
+		{
+			desc:     "comm longer than the kernel keeps",
+			matchers: []ProcessMatcher{{Name: "agent", Comm: "amazon-ssm-agent"}},
+		},
+		{
+			desc:     "comm as long as the kernel keeps",
+			matchers: []ProcessMatcher{{Name: "agent", Comm: "amazon-ssm-agen"}},
+			valid:    true,
+		},
+		{
+			desc: "one criterion each",
+			matchers: []ProcessMatcher{
+				{Name: "web", Comm: "nginx"},
+				{Name: "worker", Cmdline: `python3? .*worker\.py`},
+				{Name: "ssh", Pidfile: "/run/sshd.pid"},
+			},
+			valid: true,
+		},
+	} {
+		_, err := NewProcessChecksCollector(ProcessChecksCollectorConfig{
+			Matchers: tc.matchers,
+		})
+
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", tc.desc, err)
+		}
+
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected the matchers to be rejected", tc.desc)
+		}
+	}
+}
+
+func TestProcessChecksCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var original = procDirectory
+	defer func() {
+		procDirectory = original
+	}()
+	procDirectory = filepath.Join(dir, "proc")
+
+	writeProcessFixture(t, procDirectory, 100, "nginx", "S", "nginx: master process /usr/sbin/nginx")
+	writeProcessFixture(t, procDirectory, 101, "nginx", "S", "nginx: worker process")
+	writeProcessFixture(t, procDirectory, 102, "nginx", "Z")
+	writeProcessFixture(t, procDirectory, 200, "python3", "S", "/usr/bin/python3", "/opt/app/worker.py", "--queue", "default")
+	writeProcessFixture(t, procDirectory, 300, "sshd", "S", "/usr/sbin/sshd", "-D")
+	writeProcessFixture(t, procDirectory, os.Getpid(), "nginx", "R", "nginx")
+
+	var pidfile = func(name, content string) string {
+		var path = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var matchers = []ProcessMatcher{
+		{Name: "nginx", Comm: "nginx"},
+		{Name: "apache", Comm: "apache2"},
+		{Name: "nginx-workers", Cmdline: "^nginx: worker"},
+		{Name: "worker", Cmdline: `python3? /opt/app/worker\.py --queue default$`},
+		{Name: "sshd", Pidfile: pidfile("sshd.pid", "300\n")},
+		{Name: "zombie", Pidfile: pidfile("zombie.pid", "102")},
+		{Name: "exited", Pidfile: pidfile("exited.pid", "999")},
+		{Name: "missing", Pidfile: filepath.Join(dir, "missing.pid")},
+	}
+
+	collector, err := NewProcessChecksCollector(ProcessChecksCollectorConfig{
+		Matchers: matchers,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		counts = map[string]float64{}
+		ups    = map[string]float64{}
+	)
+
+	for _, stat := range stats {
+		switch stat.Name {
+		case "ProcessCount":
+			counts[stat.ExtraDimensions["Matcher"]] = stat.Value
+		case "ProcessUp":
+			ups[stat.ExtraDimensions["Matcher"]] = stat.Value
+		}
+	}
+
+	var expected = map[string]float64{
+		"nginx":         2,
+		"apache":        0,
+		"nginx-workers": 1,
+		"worker":        1,
+		"sshd":          1,
+		"zombie":        0,
+		"exited":        0,
+		"missing":       0,
+	}
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected counts %v, got %v", expected, counts)
+	}
+
+	for name, count := range expected {
+		if up := ups[name]; (count > 0) != (up == 1) {
+			t.Errorf("%s: expected up to reflect a count of %f, got %f", name, count, up)
+		}
+	}
+}
+
+func TestProcessChecksCollectorReportsInvalidPidfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var original = procDirectory
+	defer func() {
+		procDirectory = original
+	}()
+	procDirectory = filepath.Join(dir, "proc")
+
+	writeProcessFixture(t, procDirectory, 300, "sshd", "S", "/usr/sbin/sshd", "-D")
+
+	var invalid = filepath.Join(dir, "invalid.pid")
+	if err := ioutil.WriteFile(invalid, []byte("not a pid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	collector, err := NewProcessChecksCollector(ProcessChecksCollectorConfig{
+		Matchers: []ProcessMatcher{
+			{Name: "invalid", Pidfile: invalid},
+			{Name: "sshd", Comm: "sshd"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := collector.Collect(context.Background())
+	if err == nil {
+		t.Fatal("expected the invalid pidfile to be reported")
+	}
+
+	if len(stats) != 4 {
+		t.Fatalf("expected the other matchers to still be reported, got %d stats", len(stats))
+	}
+}
@@ -0,0 +1,163 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ProcessesCollectorConfig configures the `processes` collector.
+type ProcessesCollectorConfig struct {
+	// Top is the number of processes reported out of the
+	// ones using the most cpu and, separately, the ones
+	// using the most memory.
+	Top int `json:"top"`
+
+	// Allowlist lists the names of processes whose cpu,
+	// memory, threads and open files are always reported.
+	Allowlist []string `json:"allowlist"`
+}
+
+// ProcessesCollector gathers per-process stats by walking
+// /proc, grouping processes by name (e.g., all the workers
+// of a web server are reported together).
+type ProcessesCollector struct {
+	cfg       ProcessesCollectorConfig
+	allowlist map[string]bool
+	previous  ProcessSnapshot
+}
+
+func init() {
+	RegisterCollector("processes", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = ProcessesCollectorConfig{
+			Top: 5,
+		}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewProcessesCollector(cfg)
+		return
+	})
+}
+
+// NewProcessesCollector creates a processes collector, taking
+// an initial snapshot so that the first collection already has
+// something to compare against.
+func NewProcessesCollector(cfg ProcessesCollectorConfig) (collector *ProcessesCollector, err error) {
+	if cfg.Top < 0 {
+		err = errors.Errorf("top must not be negative (%d)", cfg.Top)
+		return
+	}
+
+	previous, err := ReadProcessSnapshot()
+	if err != nil {
+		return
+	}
+
+	collector = &ProcessesCollector{
+		cfg:       cfg,
+		allowlist: make(map[string]bool, len(cfg.Allowlist)),
+		previous:  previous,
+	}
+
+	for _, name := range cfg.Allowlist {
+		collector.allowlist[name] = true
+	}
+
+	return
+}
+
+func (c *ProcessesCollector) Name() string {
+	return "processes"
+}
+
+// Collect reports the allowlisted processes as well as the
+// top ones by cpu and by memory, covering the time since the
+// last collection.
+func (c *ProcessesCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	current, err := ReadProcessSnapshot()
+	if err != nil {
+		return
+	}
+
+	var (
+		samples  = TakeProcessSamples(c.previous, current)
+		failures []string
+	)
+
+	c.previous = current
+
+	for idx := range samples {
+		var sample = &samples[idx]
+		if !c.allowlist[sample.Name] {
+			continue
+		}
+
+		countErr := countOpenFiles(sample)
+		if countErr != nil {
+			failures = append(failures, countErr.Error())
+		}
+
+		stats = append(stats,
+			NewProcessCPUUtilizationStat(sample),
+			NewProcessMemoryRSSStat(sample),
+			NewProcessThreadsStat(sample),
+			NewProcessOpenFilesStat(sample))
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].CPU > samples[j].CPU
+	})
+	for idx := 0; idx < c.cfg.Top && idx < len(samples); idx++ {
+		if !c.allowlist[samples[idx].Name] {
+			stats = append(stats, NewProcessCPUUtilizationStat(&samples[idx]))
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].RSS > samples[j].RSS
+	})
+	for idx := 0; idx < c.cfg.Top && idx < len(samples); idx++ {
+		if !c.allowlist[samples[idx].Name] {
+			stats = append(stats, NewProcessMemoryRSSStat(&samples[idx]))
+		}
+	}
+
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to count open files of %d processes: %s",
+			len(failures), strings.Join(failures, "; "))
+		return
+	}
+
+	return
+}
+
+// countOpenFiles fills the number of files opened by all the
+// processes of a sample, ignoring those that exited since the
+// snapshot was taken.
+func countOpenFiles(sample *ProcessSample) (err error) {
+	sample.OpenFiles = 0
+
+	for _, pid := range sample.Pids {
+		count, countErr := CountProcessFiles(pid)
+		if countErr != nil {
+			if os.IsNotExist(errors.Cause(countErr)) {
+				continue
+			}
+
+			err = countErr
+			return
+		}
+
+		sample.OpenFiles += float64(count)
+	}
+
+	return
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SystemdCollectorConfig configures the `systemd` collector.
+type SystemdCollectorConfig struct {
+	// Units lists the systemd units to report the state
+	// of (e.g., `nginx.service`).
+	Units []string `json:"units"`
+}
+
+// SystemdCollector gathers the state of systemd units from
+// the output of `systemctl show`.
+type SystemdCollector struct {
+	cfg SystemdCollectorConfig
+	run CommandRunner
+}
+
+func init() {
+	RegisterCollector("systemd", func(raw json.RawMessage) (collector Collector, err error) {
+		var cfg = SystemdCollectorConfig{}
+
+		err = decodeCollectorConfig(raw, &cfg)
+		if err != nil {
+			return
+		}
+
+		collector, err = NewSystemdCollector(cfg, runCommand)
+		return
+	})
+}
+
+// NewSystemdCollector creates a systemd collector that runs
+// `systemctl` using `run`.
+func NewSystemdCollector(cfg SystemdCollectorConfig, run CommandRunner) (collector *SystemdCollector, err error) {
+	if len(cfg.Units) == 0 {
+		err = errors.Errorf("at least one systemd unit must be configured")
+		return
+	}
+
+	collector = &SystemdCollector{
+		cfg: cfg,
+		run: run,
+	}
+	return
+}
+
+func (c *SystemdCollector) Name() string {
+	return "systemd"
+}
+
+// Collect retrieves the state of the configured units. Units
+// that systemd doesn't know about are reported as inactive
+// along with an error.
+func (c *SystemdCollector) Collect(ctx context.Context) (stats []Stat, err error) {
+	states, err := ReadSystemdUnitStates(ctx, c.run, c.cfg.Units)
+	if err != nil {
+		return
+	}
+
+	var missing []string
+	for idx := range states {
+		var state = &states[idx]
+		if state.LoadState == "not-found" {
+			missing = append(missing, state.Unit)
+		}
+
+		stats = append(stats,
+			NewSystemdUnitActiveStat(state),
+			NewSystemdUnitFailedStat(state),
+			NewSystemdUnitRestartingStat(state),
+			NewSystemdUnitRestartsStat(state))
+	}
+
+	if len(missing) > 0 {
+		err = errors.Errorf("systemd units not found: %s",
+			strings.Join(missing, ", "))
+		return
+	}
+
+	return
+}
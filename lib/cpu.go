@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CPUTimes holds the cumulative time (in USER_HZ) spent by
+// a cpu (or all of them) in each mode as reported by
+// /proc/stat.
+type CPUTimes struct {
+	User    uint64
+	Nice    uint64
+	System  uint64
+	Idle    uint64
+	IOWait  uint64
+	IRQ     uint64
+	SoftIRQ uint64
+	Steal   uint64
+}
+
+// CPUSample represents the percentage of time spent by
+// a cpu in each mode between two reads of /proc/stat.
+//
+// Core is empty for the sample that aggregates all the
+// cpus, in which case Cores holds the per-core breakdown
+// (if requested).
+type CPUSample struct {
+	Core    string
+	User    float64
+	Nice    float64
+	System  float64
+	IOWait  float64
+	IRQ     float64
+	SoftIRQ float64
+	Steal   float64
+	Idle    float64
+	Cores   []CPUSample
+	When    time.Time
+}
+
+var (
+	procStatFileName = "/proc/stat"
+)
+
+// total sums the time spent in all modes.
+//
+// Guest times are not taken into account given that
+// they're already accounted in user and nice.
+func (t CPUTimes) total() uint64 {
+	return t.User + t.Nice + t.System + t.Idle +
+		t.IOWait + t.IRQ + t.SoftIRQ + t.Steal
+}
+
+// ReadCPUTimes retrieves the cumulative cpu times from
+// /proc/stat, keyed by cpu (`cpu` for the aggregate,
+// `cpu0`, `cpu1` ... for each core).
+func ReadCPUTimes() (times map[string]CPUTimes, err error) {
+	data, err := ioutil.ReadFile(procStatFileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read stat file")
+		return
+	}
+
+	times, err = parseCPUTimes(string(data))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse cpu times")
+		return
+	}
+
+	return
+}
+
+// parseCPUTimes parses the `cpu` lines of /proc/stat.
+func parseCPUTimes(data string) (times map[string]CPUTimes, err error) {
+	times = map[string]CPUTimes{}
+
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		if len(fields) < 9 {
+			err = errors.Errorf("unexpected cpu line '%s'", line)
+			return
+		}
+
+		var values = make([]uint64, 8)
+		for i, field := range fields[1:9] {
+			values[i], err = strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				err = errors.Errorf("could not parse cpu time '%s': %s", field, err)
+				return
+			}
+		}
+
+		times[fields[0]] = CPUTimes{
+			User:    values[0],
+			Nice:    values[1],
+			System:  values[2],
+			Idle:    values[3],
+			IOWait:  values[4],
+			IRQ:     values[5],
+			SoftIRQ: values[6],
+			Steal:   values[7],
+		}
+	}
+
+	if _, found := times["cpu"]; !found {
+		err = errors.Errorf("no aggregate cpu line found")
+		return
+	}
+
+	return
+}
+
+// TakeCPUSample reads /proc/stat and computes the cpu
+// utilization per mode since the `previous` read.
+//
+// The times read are returned so that they can be used
+// as `previous` in the next call.
+func TakeCPUSample(previous map[string]CPUTimes, perCore bool) (sample CPUSample, current map[string]CPUTimes, err error) {
+	current, err = ReadCPUTimes()
+	if err != nil {
+		return
+	}
+
+	sample = computeCPUSample("", previous["cpu"], current["cpu"])
+	sample.When = time.Now()
+
+	if !perCore {
+		return
+	}
+
+	var cores = make([]string, 0, len(current))
+	for name := range current {
+		if name != "cpu" {
+			cores = append(cores, name)
+		}
+	}
+	sort.Strings(cores)
+
+	for _, name := range cores {
+		prev, found := previous[name]
+		if !found {
+			continue
+		}
+
+		core := computeCPUSample(name, prev, current[name])
+		core.When = sample.When
+		sample.Cores = append(sample.Cores, core)
+	}
+
+	return
+}
+
+// computeCPUSample computes the percentage of time spent
+// in each mode between two reads of a cpu's times.
+//
+// When no time got accounted between the reads (e.g., both
+// happened within the same tick), the cpu is considered idle.
+func computeCPUSample(core string, prev, curr CPUTimes) (sample CPUSample) {
+	sample.Core = core
+
+	var total = delta(prev.total(), curr.total())
+	if total == 0 {
+		sample.Idle = 100
+		return
+	}
+
+	percent := func(p, c uint64) float64 {
+		return float64(delta(p, c)) / float64(total) * 100
+	}
+
+	sample.User = percent(prev.User, curr.User)
+	sample.Nice = percent(prev.Nice, curr.Nice)
+	sample.System = percent(prev.System, curr.System)
+	sample.IOWait = percent(prev.IOWait, curr.IOWait)
+	sample.IRQ = percent(prev.IRQ, curr.IRQ)
+	sample.SoftIRQ = percent(prev.SoftIRQ, curr.SoftIRQ)
+	sample.Steal = percent(prev.Steal, curr.Steal)
+	sample.Idle = percent(prev.Idle, curr.Idle)
+	return
+}
+
+// delta computes the difference between two reads of a
+// cumulative counter, treating counters that went backwards
+// (e.g., iowait, or a reset) as no progress.
+func delta(prev, curr uint64) uint64 {
+	if curr < prev {
+		return 0
+	}
+
+	return curr - prev
+}
@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeCPUSample(t *testing.T) {
+	var prev = CPUTimes{
+		User:   100,
+		System: 50,
+		Idle:   800,
+		IOWait: 50,
+	}
+
+	for _, tc := range []struct {
+		desc        string
+		curr        CPUTimes
+		utilization float64
+		idle        float64
+		iowait      float64
+	}{
+		{
+			desc:        "no time elapsed",
+			curr:        prev,
+			utilization: 0,
+			idle:        100,
+		},
+		{
+			desc: "counters went backwards",
+			curr: CPUTimes{
+				User: 10, System: 5, Idle: 80, IOWait: 5,
+			},
+			utilization: 0,
+			idle:        100,
+		},
+		{
+			desc: "busy and idle",
+			curr: CPUTimes{
+				User: 130, Nice: 10, System: 60, Idle: 850, IOWait: 50,
+			},
+			utilization: 50,
+			idle:        50,
+		},
+		{
+			desc: "waiting for io",
+			curr: CPUTimes{
+				User: 110, System: 50, Idle: 860, IOWait: 80,
+			},
+			utilization: 10,
+			idle:        60,
+			iowait:      30,
+		},
+	} {
+		var sample = computeCPUSample("cpu0", prev, tc.curr)
+
+		if sample.Idle != tc.idle {
+			t.Errorf("%s: expected idle %v, got %v", tc.desc, tc.idle, sample.Idle)
+		}
+
+		if sample.IOWait != tc.iowait {
+			t.Errorf("%s: expected iowait %v, got %v", tc.desc, tc.iowait, sample.IOWait)
+		}
+
+		if stat := NewCPUUtilizationStat(&sample); stat.Value != tc.utilization {
+			t.Errorf("%s: expected utilization %v, got %v", tc.desc, tc.utilization, stat.Value)
+		}
+	}
+}
+
+func TestParseCPUTimes(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		data     string
+		expected map[string]CPUTimes
+		fails    bool
+	}{
+		{
+			desc: "aggregate and cores",
+			data: "cpu  200 10 100 5000 50 1 2 3 0 0\n" +
+				"cpu0 100 5 50 2500 25 1 1 2 0 0\n" +
+				"cpu1 100 5 50 2500 25 0 1 1 0 0\n" +
+				"intr 12345 0 0\nctxt 98765\nbtime 1500000000\n",
+			expected: map[string]CPUTimes{
+				"cpu":  {User: 200, Nice: 10, System: 100, Idle: 5000, IOWait: 50, IRQ: 1, SoftIRQ: 2, Steal: 3},
+				"cpu0": {User: 100, Nice: 5, System: 50, Idle: 2500, IOWait: 25, IRQ: 1, SoftIRQ: 1, Steal: 2},
+				"cpu1": {User: 100, Nice: 5, System: 50, Idle: 2500, IOWait: 25, IRQ: 0, SoftIRQ: 1, Steal: 1},
+			},
+		},
+		{
+			desc:  "no aggregate line",
+			data:  "cpu0 100 5 50 2500 25 1 1 2 0 0\n",
+			fails: true,
+		},
+		{
+			desc:  "truncated line",
+			data:  "cpu  200 10 100 5000\n",
+			fails: true,
+		},
+		{
+			desc:  "invalid time",
+			data:  "cpu  200 10 100 5000 50 1 2 x\n",
+			fails: true,
+		},
+	} {
+		times, err := parseCPUTimes(tc.data)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(times, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, times)
+		}
+	}
+}
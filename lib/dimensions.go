@@ -0,0 +1,47 @@
+package lib
+
+// InstanceDimensions identifies the instance that stats come
+// from, using the same dimension names as the CloudWatch
+// reporter. Empty fields are left out.
+type InstanceDimensions struct {
+	InstanceId       string `json:"instance-id"`
+	InstanceType     string `json:"instance-type"`
+	AutoScalingGroup string `json:"autoscaling-group"`
+}
+
+// Map converts the dimensions into a map of dimension name
+// to value.
+func (d InstanceDimensions) Map() (dimensions map[string]string) {
+	dimensions = map[string]string{}
+
+	if d.InstanceType != "" {
+		dimensions["InstanceType"] = d.InstanceType
+	}
+
+	if d.InstanceId != "" {
+		dimensions["InstanceId"] = d.InstanceId
+	}
+
+	if d.AutoScalingGroup != "" {
+		dimensions["AutoScalingGroupName"] = d.AutoScalingGroup
+	}
+
+	return
+}
+
+// mergeDimensions combines the base dimensions of a reporter
+// with the ones specific to a stat, the latter taking
+// precedence.
+func mergeDimensions(base, extra map[string]string) (dimensions map[string]string) {
+	dimensions = make(map[string]string, len(base)+len(extra))
+
+	for k, v := range base {
+		dimensions[k] = v
+	}
+
+	for k, v := range extra {
+		dimensions[k] = v
+	}
+
+	return
+}
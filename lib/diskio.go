@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// diskSectorSize is the size of the sectors reported in
+// /proc/diskstats, regardless of the device.
+const diskSectorSize = 512
+
+// DiskStats holds the cumulative io counters of a block
+// device as reported by /proc/diskstats.
+type DiskStats struct {
+	Major           int
+	Minor           int
+	Device          string
+	ReadsCompleted  uint64
+	SectorsRead     uint64
+	ReadTime        uint64
+	WritesCompleted uint64
+	SectorsWritten  uint64
+	WriteTime       uint64
+	WeightedIOTime  uint64
+}
+
+// DiskIOSnapshot holds the io counters of all the block
+// devices at a given point in time.
+type DiskIOSnapshot struct {
+	Devices []DiskStats
+	When    time.Time
+}
+
+// DiskIOSample represents the io activity of the device
+// backing a mounted filesystem between two snapshots.
+//
+// Elapsed is the time covered by the sample, which is zero
+// when the device wasn't in the previous snapshot (e.g., a
+// volume attached since then).
+type DiskIOSample struct {
+	Path                string
+	Device              string
+	ReadBytesPerSecond  float64
+	WriteBytesPerSecond float64
+	ReadOpsPerSecond    float64
+	WriteOpsPerSecond   float64
+	QueueDepth          float64
+	Await               float64
+	Elapsed             time.Duration
+	When                time.Time
+}
+
+var (
+	diskstatsFileName = "/proc/diskstats"
+)
+
+// ReadDiskIOSnapshot retrieves the io counters of all the
+// block devices from /proc/diskstats.
+func ReadDiskIOSnapshot() (snapshot DiskIOSnapshot, err error) {
+	data, err := ioutil.ReadFile(diskstatsFileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read diskstats file")
+		return
+	}
+
+	snapshot.When = time.Now()
+	snapshot.Devices, err = parseDiskStats(string(data))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse diskstats")
+		return
+	}
+
+	return
+}
+
+// parseDiskStats parses the contents of /proc/diskstats.
+func parseDiskStats(data string) (devices []DiskStats, err error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 14 {
+			err = errors.Errorf("unexpected diskstats line '%s'", line)
+			return
+		}
+
+		var values = make([]uint64, 11)
+		for i, field := range fields[3:14] {
+			values[i], err = strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				err = errors.Errorf("could not parse counter '%s': %s", field, err)
+				return
+			}
+		}
+
+		var device = DiskStats{
+			Device:          fields[2],
+			ReadsCompleted:  values[0],
+			SectorsRead:     values[2],
+			ReadTime:        values[3],
+			WritesCompleted: values[4],
+			SectorsWritten:  values[6],
+			WriteTime:       values[7],
+			WeightedIOTime:  values[10],
+		}
+
+		device.Major, device.Minor, err = parseDeviceNumber(fields[0] + ":" + fields[1])
+		if err != nil {
+			return
+		}
+
+		devices = append(devices, device)
+	}
+
+	return
+}
+
+// find looks for the counters of the device backing a mount,
+// first by device number and then by the name of the mount
+// source (e.g., `/dev/xvda1`).
+func (s DiskIOSnapshot) find(mount MountInfo) (device DiskStats, found bool) {
+	for _, device = range s.Devices {
+		if device.Major == mount.Major && device.Minor == mount.Minor {
+			found = true
+			return
+		}
+	}
+
+	var name = filepath.Base(mount.Source)
+	for _, device = range s.Devices {
+		if device.Device == name {
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+// TakeDiskIOSample computes the io activity of the device that
+// backs the filesystem mounted at `path` between the `previous`
+// and the `current` snapshots.
+func TakeDiskIOSample(path string, mounts []MountInfo, previous, current DiskIOSnapshot) (sample DiskIOSample, err error) {
+	mount, found := FindMount(mounts, path)
+	if !found {
+		err = errors.Errorf("Couldn't find mount for path %s", path)
+		return
+	}
+
+	curr, found := current.find(mount)
+	if !found {
+		err = errors.Errorf(
+			"Couldn't find block device for path %s (source %s, device %d:%d)",
+			path, mount.Source, mount.Major, mount.Minor)
+		return
+	}
+
+	sample.Path = path
+	sample.Device = curr.Device
+	sample.When = current.When
+
+	prev, found := previous.find(mount)
+	if !found {
+		return
+	}
+
+	var (
+		elapsed = current.When.Sub(previous.When)
+		seconds = elapsed.Seconds()
+		reads   = delta(prev.ReadsCompleted, curr.ReadsCompleted)
+		writes  = delta(prev.WritesCompleted, curr.WritesCompleted)
+		ioTime  = delta(prev.ReadTime, curr.ReadTime) +
+			delta(prev.WriteTime, curr.WriteTime)
+	)
+
+	if seconds <= 0 {
+		return
+	}
+
+	sample.ReadBytesPerSecond =
+		float64(delta(prev.SectorsRead, curr.SectorsRead)*diskSectorSize) / seconds
+	sample.WriteBytesPerSecond =
+		float64(delta(prev.SectorsWritten, curr.SectorsWritten)*diskSectorSize) / seconds
+	sample.ReadOpsPerSecond = float64(reads) / seconds
+	sample.WriteOpsPerSecond = float64(writes) / seconds
+	sample.QueueDepth =
+		float64(delta(prev.WeightedIOTime, curr.WeightedIOTime)) / (seconds * 1000)
+	sample.Elapsed = elapsed
+
+	if reads+writes > 0 {
+		sample.Await = float64(ioTime) / float64(reads+writes)
+	}
+
+	return
+}
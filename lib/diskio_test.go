@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDiskStats(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		data     string
+		expected []DiskStats
+		fails    bool
+	}{
+		{
+			desc: "kernel 4.18+ with discard and flush fields",
+			data: " 202       0 xvda 1000 10 20000 500 2000 20 40000 1500 0 1800 2100 0 0 0 0 0 0\n" +
+				" 202       1 xvda1 900 10 18000 450 2000 20 40000 1500 0 1700 1950\n",
+			expected: []DiskStats{
+				{
+					Major: 202, Minor: 0, Device: "xvda",
+					ReadsCompleted: 1000, SectorsRead: 20000, ReadTime: 500,
+					WritesCompleted: 2000, SectorsWritten: 40000, WriteTime: 1500,
+					WeightedIOTime: 2100,
+				},
+				{
+					Major: 202, Minor: 1, Device: "xvda1",
+					ReadsCompleted: 900, SectorsRead: 18000, ReadTime: 450,
+					WritesCompleted: 2000, SectorsWritten: 40000, WriteTime: 1500,
+					WeightedIOTime: 1950,
+				},
+			},
+		},
+		{
+			desc:  "truncated line",
+			data:  " 202 0 xvda 1000 10 20000\n",
+			fails: true,
+		},
+		{
+			desc:  "invalid counter",
+			data:  " 202 0 xvda 1000 10 20000 500 2000 20 40000 1500 0 1800 many\n",
+			fails: true,
+		},
+	} {
+		devices, err := parseDiskStats(tc.data)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(devices, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, devices)
+		}
+	}
+}
+
+func TestTakeDiskIOSample(t *testing.T) {
+	var (
+		now    = time.Now()
+		mounts = []MountInfo{
+			{Major: 202, Minor: 1, MountPoint: "/", FsType: "ext4", Source: "/dev/xvda1"},
+			{Major: 0, Minor: 45, MountPoint: "/data", FsType: "btrfs", Source: "/dev/xvdf"},
+		}
+		previous = DiskIOSnapshot{
+			When: now.Add(-10 * time.Second),
+			Devices: []DiskStats{
+				{Major: 202, Minor: 1, Device: "xvda1", ReadsCompleted: 100, WritesCompleted: 100},
+				{Major: 202, Minor: 80, Device: "xvdf"},
+			},
+		}
+		current = DiskIOSnapshot{
+			When: now,
+			Devices: []DiskStats{
+				{
+					Major: 202, Minor: 1, Device: "xvda1",
+					ReadsCompleted: 200, SectorsRead: 20480, ReadTime: 400,
+					WritesCompleted: 150, SectorsWritten: 10240, WriteTime: 100,
+					WeightedIOTime: 5000,
+				},
+				{Major: 202, Minor: 80, Device: "xvdf", ReadsCompleted: 10},
+			},
+		}
+	)
+
+	sample, err := TakeDiskIOSample("/var/log", mounts, previous, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = DiskIOSample{
+		Path:                "/var/log",
+		Device:              "xvda1",
+		ReadBytesPerSecond:  1048576,
+		WriteBytesPerSecond: 524288,
+		ReadOpsPerSecond:    10,
+		WriteOpsPerSecond:   5,
+		QueueDepth:          0.5,
+		Await:               500.0 / 150,
+		Elapsed:             10 * time.Second,
+		When:                now,
+	}
+	if sample != expected {
+		t.Fatalf("expected %+v, got %+v", expected, sample)
+	}
+
+	// btrfs reports an anonymous device number, so the device
+	// is found by the name of the mount source.
+	sample, err = TakeDiskIOSample("/data", mounts, previous, current)
+	if err != nil || sample.Device != "xvdf" || sample.ReadOpsPerSecond != 1 {
+		t.Fatalf("expected xvdf to be found by name, got %+v (%v)", sample, err)
+	}
+
+	_, err = TakeDiskIOSample("/", mounts[1:], previous, current)
+	if err == nil {
+		t.Fatal("expected an error for a path without a mount")
+	}
+
+	// a device attached since the previous snapshot has
+	// nothing to be compared against.
+	sample, err = TakeDiskIOSample("/", mounts, DiskIOSnapshot{When: previous.When}, current)
+	if err != nil || sample.Elapsed != 0 || sample.ReadOpsPerSecond != 0 {
+		t.Fatalf("expected no rates for a new device, got %+v (%v)", sample, err)
+	}
+
+	// reads less than a millisecond apart still make a
+	// finite queue depth.
+	previous.When = now.Add(-500 * time.Microsecond)
+	sample, err = TakeDiskIOSample("/", mounts, previous, current)
+	if err != nil || math.IsInf(sample.QueueDepth, 0) || math.IsNaN(sample.QueueDepth) {
+		t.Fatalf("expected a finite queue depth, got %+v (%v)", sample, err)
+	}
+}
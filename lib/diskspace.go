@@ -11,8 +11,15 @@ import (
 type DiskSample struct {
 	DiskUtilization   float64
 	InodesUtilization float64
-	When              time.Time
-	Path              string
+
+	// Total, Used and Free (i.e., available to unprivileged
+	// users) space of the filesystem, in bytes.
+	Total float64
+	Used  float64
+	Free  float64
+
+	When time.Time
+	Path string
 }
 
 // TakeDiskSample retrieves a sample about disk utilization
@@ -36,8 +43,20 @@ func TakeDiskSample(path string) (sample DiskSample, err error) {
 	inodesFree := int(fsInfo.Ffree)
 
 	sample.Path = path
-	sample.InodesUtilization = Round(100 * (1 - float64(inodesFree)/float64(inodesTotal)))
-	sample.DiskUtilization = Round((float64(diskUsed) / float64(diskTotal)) * 100)
+	sample.Total = float64(diskTotal)
+	sample.Used = float64(diskUsed)
+	sample.Free = float64(diskAvail)
 	sample.When = time.Now()
+
+	// some filesystems (e.g., btrfs) have no fixed number
+	// of inodes, reporting 0 of them.
+	if inodesTotal > 0 {
+		sample.InodesUtilization = 100 * (1 - float64(inodesFree)/float64(inodesTotal))
+	}
+
+	if diskTotal > 0 {
+		sample.DiskUtilization = (float64(diskUsed) / float64(diskTotal)) * 100
+	}
+
 	return
 }
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// FailurePolicy decides when repeated failures of a single
+// source (a collector, a reporter ...) become fatal.
+type FailurePolicy struct {
+	// MaxConsecutiveFailures is the number of consecutive
+	// failures of a single source after which the failure
+	// is considered fatal. Zero means that failures are never
+	// fatal.
+	MaxConsecutiveFailures int
+}
+
+// FailureTracker keeps count of the failures of each source,
+// letting the daemon keep going when a single source fails
+// until the policy says otherwise.
+type FailureTracker struct {
+	logger zerolog.Logger
+	policy FailurePolicy
+
+	mu          sync.Mutex
+	consecutive map[string]int
+	total       map[string]int
+}
+
+func NewFailureTracker(policy FailurePolicy) (tracker *FailureTracker) {
+	tracker = &FailureTracker{
+		logger:      log.With().Str("from", "failures").Logger(),
+		policy:      policy,
+		consecutive: map[string]int{},
+		total:       map[string]int{},
+	}
+	return
+}
+
+// Success records a successful operation from `source`,
+// resetting its count of consecutive failures.
+func (t *FailureTracker) Success(source string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.consecutive[source] > 0 {
+		t.logger.Info().
+			Str("source", source).
+			Int("consecutive", t.consecutive[source]).
+			Msg("source recovered")
+	}
+
+	t.consecutive[source] = 0
+}
+
+// Failure records a failed operation from `source`.
+//
+// A non-nil error is returned if, according to the policy,
+// the failure should be considered fatal.
+func (t *FailureTracker) Failure(source string, cause error) (err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.consecutive[source]++
+	t.total[source]++
+
+	t.logger.Error().
+		Err(cause).
+		Str("source", source).
+		Int("consecutive", t.consecutive[source]).
+		Int("total", t.total[source]).
+		Msg("source failed")
+
+	if t.policy.MaxConsecutiveFailures > 0 &&
+		t.consecutive[source] >= t.policy.MaxConsecutiveFailures {
+		err = errors.Wrapf(cause,
+			"%s failed %d consecutive times",
+			source, t.consecutive[source])
+		return
+	}
+
+	return
+}
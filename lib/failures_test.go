@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFailureTracker(t *testing.T) {
+	var cause = errors.New("unreachable")
+
+	for _, tc := range []struct {
+		desc   string
+		max    int
+		events []string // `collector` or `reporter` fails, `ok` succeeds both
+		fatal  int      // index of the event expected to be fatal (-1 for none)
+	}{
+		{
+			desc:   "never fatal without a maximum",
+			max:    0,
+			events: []string{"reporter", "reporter", "reporter", "reporter"},
+			fatal:  -1,
+		},
+		{
+			desc:   "fatal once the maximum is reached",
+			max:    3,
+			events: []string{"reporter", "reporter", "reporter"},
+			fatal:  2,
+		},
+		{
+			desc:   "successes reset the count",
+			max:    2,
+			events: []string{"reporter", "ok", "reporter", "ok", "reporter"},
+			fatal:  -1,
+		},
+		{
+			desc:   "sources are counted separately",
+			max:    2,
+			events: []string{"reporter", "collector", "ok", "collector", "reporter"},
+			fatal:  -1,
+		},
+	} {
+		var tracker = NewFailureTracker(FailurePolicy{
+			MaxConsecutiveFailures: tc.max,
+		})
+
+		for idx, event := range tc.events {
+			var err error
+
+			switch event {
+			case "ok":
+				tracker.Success("reporter")
+				tracker.Success("collector")
+			default:
+				err = tracker.Failure(event, cause)
+			}
+
+			if (err != nil) != (idx == tc.fatal) {
+				t.Errorf("%s: unexpected outcome of event %d (%s): %v", tc.desc, idx, event, err)
+			}
+
+			if err != nil && errors.Cause(err) != cause {
+				t.Errorf("%s: expected the cause to be kept, got %v", tc.desc, err)
+			}
+		}
+	}
+}
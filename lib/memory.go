@@ -10,16 +10,55 @@ import (
 type MemorySample struct {
 	MemoryUtilization float64
 	SwapUtilization   float64
-	When              time.Time
+
+	// Total and Used memory as well as the memory used for
+	// buffers and page cache, in bytes.
+	Total   float64
+	Used    float64
+	Buffers float64
+	Cached  float64
+
+	// Available is the kernel's estimate of the memory
+	// available for new applications (`MemAvailable`) in
+	// bytes, regardless of the mode. Kernels older than 3.14
+	// don't report it, in which case it's the memory not
+	// in use.
+	Available float64
+
+	// Mode is the mode in which the memory in use was
+	// calculated, which is legacy on kernels that don't
+	// report `MemAvailable`.
+	Mode MemoryMode
+
+	When time.Time
 }
 
+// MemoryMode determines how the memory in use is calculated.
+type MemoryMode string
+
+const (
+	// MemoryModeAvailable considers as used all the memory
+	// that the kernel doesn't estimate to be available
+	// (`MemTotal - MemAvailable`), which accounts for the
+	// page cache that can't be reclaimed.
+	MemoryModeAvailable MemoryMode = "available"
+
+	// MemoryModeLegacy considers as used all the memory
+	// that is neither free nor used for buffers or page
+	// cache (`MemTotal - MemFree - Buffers - Cached`).
+	MemoryModeLegacy MemoryMode = "legacy"
+)
+
 var (
 	memInfo = &procmeminfo.MemInfo{}
 )
 
 // TakeMemorySample updates the /proc/meminfo sampler and returns
 // a struct with the desired metrics to be consumed.
-func TakeMemorySample() (sample MemorySample, err error) {
+//
+// Kernels older than 3.14 don't report `MemAvailable`, in which
+// case the legacy mode is used regardless of `mode`.
+func TakeMemorySample(mode MemoryMode) (sample MemorySample, err error) {
 	err = memInfo.Update()
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -27,18 +66,42 @@ func TakeMemorySample() (sample MemorySample, err error) {
 		return
 	}
 
-	used := float64(memInfo.Used())
-	total := float64(memInfo.Total())
-	swapUsed := float64(memInfo.Swap())
-	swapTotal := float64((*memInfo)["SwapTotal"])
+	sample = computeMemorySample(*memInfo, mode)
+	sample.When = time.Now()
+	return
+}
+
+// computeMemorySample computes the memory utilization out of
+// the values of /proc/meminfo (in bytes).
+func computeMemorySample(info procmeminfo.MemInfo, mode MemoryMode) (sample MemorySample) {
+	used := float64(info.Used())
+	total := float64(info.Total())
+	memAvailable, hasMemAvailable := info["MemAvailable"]
+	swapTotal := float64(info["SwapTotal"])
+	swapUsed := swapTotal - float64(info["SwapFree"])
 
 	if swapTotal == 0 {
 		sample.SwapUtilization = 0
 	} else {
-		sample.SwapUtilization = Round(swapUsed / swapTotal * 100)
+		sample.SwapUtilization = swapUsed / swapTotal * 100
+	}
+
+	sample.Mode = MemoryModeLegacy
+	if mode == MemoryModeAvailable && hasMemAvailable {
+		used = total - float64(memAvailable)
+		sample.Mode = MemoryModeAvailable
+	}
+
+	sample.MemoryUtilization = used / total * 100
+	sample.Total = total
+	sample.Used = used
+	sample.Buffers = float64(info["Buffers"])
+	sample.Cached = float64(info["Cached"])
+
+	sample.Available = total - used
+	if hasMemAvailable {
+		sample.Available = float64(memAvailable)
 	}
 
-	sample.MemoryUtilization = Round(used / total * 100)
-	sample.When = time.Now()
 	return
 }
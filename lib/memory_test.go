@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/guillermo/go.procmeminfo"
+)
+
+const gib = 1024 * 1024 * 1024
+
+func TestComputeMemorySampleSwap(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		info     procmeminfo.MemInfo
+		expected float64
+	}{
+		{
+			desc: "no swap",
+			info: procmeminfo.MemInfo{
+				"MemTotal": 8 * gib,
+				"MemFree":  4 * gib,
+			},
+			expected: 0,
+		},
+		{
+			desc: "unused swap",
+			info: procmeminfo.MemInfo{
+				"MemTotal":  8 * gib,
+				"MemFree":   4 * gib,
+				"SwapTotal": 2 * gib,
+				"SwapFree":  2 * gib,
+			},
+			expected: 0,
+		},
+		{
+			desc: "quarter of the swap used",
+			info: procmeminfo.MemInfo{
+				"MemTotal":  8 * gib,
+				"MemFree":   4 * gib,
+				"SwapTotal": 4 * gib,
+				"SwapFree":  3 * gib,
+			},
+			expected: 25,
+		},
+	} {
+		var sample = computeMemorySample(tc.info, MemoryModeLegacy)
+		if sample.SwapUtilization != tc.expected {
+			t.Errorf("%s: expected %v%% of swap used, got %v", tc.desc, tc.expected, sample.SwapUtilization)
+		}
+	}
+}
+
+func TestComputeMemorySampleBytes(t *testing.T) {
+	var info = procmeminfo.MemInfo{
+		"MemTotal":     8 * gib,
+		"MemFree":      1 * gib,
+		"MemAvailable": 6 * gib,
+		"Buffers":      1 * gib,
+		"Cached":       2 * gib,
+	}
+
+	for _, tc := range []struct {
+		mode     MemoryMode
+		info     procmeminfo.MemInfo
+		expected MemorySample
+	}{
+		{
+			mode: MemoryModeAvailable,
+			info: info,
+			expected: MemorySample{
+				MemoryUtilization: 25,
+				Total:             8 * gib,
+				Used:              2 * gib,
+				Available:         6 * gib,
+				Buffers:           1 * gib,
+				Cached:            2 * gib,
+				Mode:              MemoryModeAvailable,
+			},
+		},
+		{
+			mode: MemoryModeLegacy,
+			info: info,
+			expected: MemorySample{
+				MemoryUtilization: 50,
+				Total:             8 * gib,
+				Used:              4 * gib,
+				Available:         6 * gib,
+				Buffers:           1 * gib,
+				Cached:            2 * gib,
+				Mode:              MemoryModeLegacy,
+			},
+		},
+		{
+			mode: MemoryModeAvailable,
+			info: procmeminfo.MemInfo{
+				"MemTotal": 8 * gib,
+				"MemFree":  2 * gib,
+			},
+			expected: MemorySample{
+				MemoryUtilization: 75,
+				Total:             8 * gib,
+				Used:              6 * gib,
+				Available:         2 * gib,
+				Mode:              MemoryModeLegacy,
+			},
+		},
+	} {
+		var sample = computeMemorySample(tc.info, tc.mode)
+		if sample != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.mode, tc.expected, sample)
+		}
+	}
+}
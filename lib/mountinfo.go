@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MountInfo represents a mount as described by a line
+// of /proc/self/mountinfo.
+type MountInfo struct {
+	Major      int
+	Minor      int
+	MountPoint string
+	FsType     string
+	Source     string
+}
+
+var (
+	mountinfoFileName = "/proc/self/mountinfo"
+)
+
+// ReadMountInfo retrieves the list of mounts of the
+// current mount namespace.
+func ReadMountInfo() (mounts []MountInfo, err error) {
+	data, err := ioutil.ReadFile(mountinfoFileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read mountinfo file")
+		return
+	}
+
+	mounts, err = parseMountInfo(string(data))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse mountinfo")
+		return
+	}
+
+	return
+}
+
+// parseMountInfo parses the contents of a mountinfo file.
+//
+// Each line looks like the following, where the optional
+// fields are terminated by a single hyphen:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+func parseMountInfo(data string) (mounts []MountInfo, err error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var separator = -1
+		for idx := 6; idx < len(fields); idx++ {
+			if fields[idx] == "-" {
+				separator = idx
+				break
+			}
+		}
+
+		if len(fields) < 6 || separator == -1 || separator+2 >= len(fields) {
+			err = errors.Errorf("unexpected mountinfo line '%s'", line)
+			return
+		}
+
+		var mount = MountInfo{
+			MountPoint: unescapeMountField(fields[4]),
+			FsType:     fields[separator+1],
+			Source:     unescapeMountField(fields[separator+2]),
+		}
+
+		mount.Major, mount.Minor, err = parseDeviceNumber(fields[2])
+		if err != nil {
+			return
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	return
+}
+
+// parseDeviceNumber parses a `major:minor` device number.
+func parseDeviceNumber(device string) (major, minor int, err error) {
+	parts := strings.Split(device, ":")
+	if len(parts) != 2 {
+		err = errors.Errorf("unexpected device number '%s'", device)
+		return
+	}
+
+	major, err = strconv.Atoi(parts[0])
+	if err != nil {
+		err = errors.Errorf("could not parse major '%s': %s", parts[0], err)
+		return
+	}
+
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		err = errors.Errorf("could not parse minor '%s': %s", parts[1], err)
+		return
+	}
+
+	return
+}
+
+// unescapeMountField decodes the octal escapes (e.g., `\040`
+// for a space) that the kernel uses in mountinfo fields.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var unescaped strings.Builder
+	for idx := 0; idx < len(field); idx++ {
+		if field[idx] == '\\' && idx+3 < len(field) {
+			code, err := strconv.ParseUint(field[idx+1:idx+4], 8, 8)
+			if err == nil {
+				unescaped.WriteByte(byte(code))
+				idx += 3
+				continue
+			}
+		}
+
+		unescaped.WriteByte(field[idx])
+	}
+
+	return unescaped.String()
+}
+
+// FindMount looks for the mount that holds `path`, i.e., the
+// one with the longest mount point that contains it. When a
+// mount point has been mounted over, the latest mount wins.
+func FindMount(mounts []MountInfo, path string) (mount MountInfo, found bool) {
+	path = filepath.Clean(path)
+
+	for _, candidate := range mounts {
+		var contains = candidate.MountPoint == "/" ||
+			path == candidate.MountPoint ||
+			strings.HasPrefix(path, candidate.MountPoint+"/")
+
+		if contains && len(candidate.MountPoint) >= len(mount.MountPoint) {
+			mount = candidate
+			found = true
+		}
+	}
+
+	return
+}
+
+// DiscoverMounts filters the mounts that hold real filesystems,
+// i.e., those whose type is not listed in `excludeFsTypes`,
+// sorted by mount point.
+//
+// A filesystem mounted at several places (e.g., bind mounts)
+// is only returned once, at its shortest mount point.
+func DiscoverMounts(mounts []MountInfo, excludeFsTypes []string) (discovered []MountInfo) {
+	var excluded = make(map[string]bool, len(excludeFsTypes))
+	for _, fsType := range excludeFsTypes {
+		excluded[fsType] = true
+	}
+
+	var candidates = make([]MountInfo, 0, len(mounts))
+	for _, mount := range mounts {
+		if !excluded[mount.FsType] {
+			candidates = append(candidates, mount)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].MountPoint) < len(candidates[j].MountPoint)
+	})
+
+	var devices = make(map[[2]int]bool, len(candidates))
+	for _, mount := range candidates {
+		var device = [2]int{mount.Major, mount.Minor}
+		if devices[device] {
+			continue
+		}
+
+		devices[device] = true
+		discovered = append(discovered, mount)
+	}
+
+	sort.Slice(discovered, func(i, j int) bool {
+		return discovered[i].MountPoint < discovered[j].MountPoint
+	})
+
+	return
+}
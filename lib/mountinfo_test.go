@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// mountinfoFixture is an excerpt of /proc/self/mountinfo of an
+// instance with a data volume that's also bind mounted.
+const mountinfoFixture = `22 28 0:21 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+28 1 202:1 / / rw,relatime shared:1 - ext4 /dev/xvda1 rw,discard
+30 28 0:25 / /run rw,nosuid,nodev shared:5 - tmpfs tmpfs rw,size=402452k,mode=755
+95 28 202:80 / /data rw,relatime shared:45 - xfs /dev/xvdf rw,attr2,inode64
+101 28 202:80 /docker /var/lib/docker rw,relatime shared:45 - xfs /dev/xvdf rw,attr2,inode64
+110 28 202:96 / /mnt/my\040disk rw,relatime - ext4 /dev/xvdg rw
+120 28 0:52 / /mnt/nfs rw,relatime shared:60 master:1 - nfs4 10.0.0.2:/exports rw,vers=4.1
+`
+
+func TestParseMountInfo(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		data     string
+		expected []MountInfo
+		fails    bool
+	}{
+		{
+			desc: "empty",
+			data: "",
+		},
+		{
+			desc: "optional fields and escapes",
+			data: "110 28 202:96 / /mnt/my\\040disk rw,relatime - ext4 /dev/xvdg rw\n" +
+				"120 28 0:52 / /mnt/nfs rw shared:60 master:1 - nfs4 10.0.0.2:/exports rw\n",
+			expected: []MountInfo{
+				{Major: 202, Minor: 96, MountPoint: "/mnt/my disk", FsType: "ext4", Source: "/dev/xvdg"},
+				{Major: 0, Minor: 52, MountPoint: "/mnt/nfs", FsType: "nfs4", Source: "10.0.0.2:/exports"},
+			},
+		},
+		{
+			desc:  "missing separator",
+			data:  "28 1 202:1 / / rw,relatime shared:1 ext4 /dev/xvda1 rw\n",
+			fails: true,
+		},
+		{
+			desc:  "missing source",
+			data:  "28 1 202:1 / / rw,relatime - ext4\n",
+			fails: true,
+		},
+		{
+			desc:  "invalid device number",
+			data:  "28 1 202 / / rw,relatime - ext4 /dev/xvda1 rw\n",
+			fails: true,
+		},
+	} {
+		mounts, err := parseMountInfo(tc.data)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(mounts, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, mounts)
+		}
+	}
+}
+
+func TestFindMount(t *testing.T) {
+	mounts, err := parseMountInfo(mountinfoFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"/":                        "/",
+		"/data":                    "/data",
+		"/data/":                   "/data",
+		"/database":                "/",
+		"/var/lib/docker/overlay2": "/var/lib/docker",
+		"/mnt/my disk/files":       "/mnt/my disk",
+	} {
+		mount, found := FindMount(mounts, path)
+		if !found || mount.MountPoint != expected {
+			t.Errorf("expected %s to be in %s, got %+v", path, expected, mount)
+		}
+	}
+}
+
+func TestDiscoverMounts(t *testing.T) {
+	mounts, err := parseMountInfo(mountinfoFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var discovered []string
+	for _, mount := range DiscoverMounts(mounts, defaultExcludeFsTypes) {
+		discovered = append(discovered, mount.MountPoint)
+	}
+
+	var expected = []string{"/", "/data", "/mnt/my disk"}
+	if !reflect.DeepEqual(discovered, expected) {
+		t.Fatalf("expected %v, got %v", expected, discovered)
+	}
+}
@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NetDevStats holds the cumulative counters of a network
+// interface as reported by /proc/net/dev.
+type NetDevStats struct {
+	Interface string
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDrops   uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDrops   uint64
+}
+
+// NetworkSnapshot holds the counters of all the network
+// interfaces at a given point in time.
+type NetworkSnapshot struct {
+	Interfaces []NetDevStats
+	When       time.Time
+}
+
+// NetworkSample represents the traffic of a network interface
+// between two snapshots, in units per second.
+//
+// Elapsed is the time covered by the sample, which is zero
+// when the interface wasn't in the previous snapshot.
+type NetworkSample struct {
+	Interface  string
+	BytesIn    float64
+	BytesOut   float64
+	PacketsIn  float64
+	PacketsOut float64
+	ErrorsIn   float64
+	ErrorsOut  float64
+	DropsIn    float64
+	DropsOut   float64
+	Elapsed    time.Duration
+	When       time.Time
+}
+
+var (
+	netDevFileName = "/proc/net/dev"
+)
+
+// ReadNetworkSnapshot retrieves the counters of all the
+// network interfaces from /proc/net/dev.
+func ReadNetworkSnapshot() (snapshot NetworkSnapshot, err error) {
+	data, err := ioutil.ReadFile(netDevFileName)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read net/dev file")
+		return
+	}
+
+	snapshot.When = time.Now()
+	snapshot.Interfaces, err = parseNetDev(string(data))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse net/dev")
+		return
+	}
+
+	return
+}
+
+// parseNetDev parses the contents of /proc/net/dev, skipping
+// the two header lines.
+func parseNetDev(data string) (interfaces []NetDevStats, err error) {
+	for _, line := range strings.Split(data, "\n") {
+		colon := strings.Index(line, ":")
+		if colon == -1 {
+			continue
+		}
+
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) < 16 {
+			err = errors.Errorf("unexpected net/dev line '%s'", line)
+			return
+		}
+
+		var values = make([]uint64, 16)
+		for i, field := range fields[:16] {
+			values[i], err = strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				err = errors.Errorf("could not parse counter '%s': %s", field, err)
+				return
+			}
+		}
+
+		interfaces = append(interfaces, NetDevStats{
+			Interface: strings.TrimSpace(line[:colon]),
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDrops:   values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDrops:   values[11],
+		})
+	}
+
+	return
+}
+
+// find looks for the counters of a given interface.
+func (s NetworkSnapshot) find(name string) (iface NetDevStats, found bool) {
+	for _, iface = range s.Interfaces {
+		if iface.Interface == name {
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+// TakeNetworkSample computes the traffic of the interface
+// `name` between the `previous` and the `current` snapshots.
+func TakeNetworkSample(name string, previous, current NetworkSnapshot) (sample NetworkSample, err error) {
+	curr, found := current.find(name)
+	if !found {
+		err = errors.Errorf("Couldn't find network interface %s", name)
+		return
+	}
+
+	sample.Interface = name
+	sample.When = current.When
+
+	prev, found := previous.find(name)
+	if !found {
+		return
+	}
+
+	var (
+		elapsed = current.When.Sub(previous.When)
+		seconds = elapsed.Seconds()
+	)
+
+	if seconds <= 0 {
+		return
+	}
+
+	rate := func(p, c uint64) float64 {
+		return float64(delta(p, c)) / seconds
+	}
+
+	sample.BytesIn = rate(prev.RxBytes, curr.RxBytes)
+	sample.BytesOut = rate(prev.TxBytes, curr.TxBytes)
+	sample.PacketsIn = rate(prev.RxPackets, curr.RxPackets)
+	sample.PacketsOut = rate(prev.TxPackets, curr.TxPackets)
+	sample.ErrorsIn = rate(prev.RxErrors, curr.RxErrors)
+	sample.ErrorsOut = rate(prev.TxErrors, curr.TxErrors)
+	sample.DropsIn = rate(prev.RxDrops, curr.RxDrops)
+	sample.DropsOut = rate(prev.TxDrops, curr.TxDrops)
+	sample.Elapsed = elapsed
+	return
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNetDev(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		data     string
+		expected []NetDevStats
+		fails    bool
+	}{
+		{
+			desc: "headers and interfaces",
+			data: `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:   12345     100    0    0    0     0          0         0    12345     100    0    0    0     0       0          0
+  eth0:1000000    2000    1    2    0     0          0         0   500000    1500    3    4    0     0       0          0
+`,
+			expected: []NetDevStats{
+				{
+					Interface: "lo",
+					RxBytes:   12345, RxPackets: 100,
+					TxBytes: 12345, TxPackets: 100,
+				},
+				{
+					Interface: "eth0",
+					RxBytes:   1000000, RxPackets: 2000, RxErrors: 1, RxDrops: 2,
+					TxBytes: 500000, TxPackets: 1500, TxErrors: 3, TxDrops: 4,
+				},
+			},
+		},
+		{
+			desc:  "truncated line",
+			data:  "  eth0: 1000 20 0 0\n",
+			fails: true,
+		},
+		{
+			desc:  "invalid counter",
+			data:  "  eth0: 1000 20 0 0 0 0 0 0 500 15 0 0 0 0 0 -1\n",
+			fails: true,
+		},
+	} {
+		interfaces, err := parseNetDev(tc.data)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(interfaces, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, interfaces)
+		}
+	}
+}
+
+func TestTakeNetworkSample(t *testing.T) {
+	var (
+		now      = time.Now()
+		previous = NetworkSnapshot{
+			When: now.Add(-10 * time.Second),
+			Interfaces: []NetDevStats{
+				{Interface: "eth0", RxBytes: 1000, TxBytes: 5000, RxPackets: 10},
+			},
+		}
+		current = NetworkSnapshot{
+			When: now,
+			Interfaces: []NetDevStats{
+				{Interface: "eth0", RxBytes: 11000, TxBytes: 6000, RxPackets: 30, TxDrops: 5},
+			},
+		}
+	)
+
+	sample, err := TakeNetworkSample("eth0", previous, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = NetworkSample{
+		Interface: "eth0",
+		BytesIn:   1000,
+		BytesOut:  100,
+		PacketsIn: 2,
+		DropsOut:  0.5,
+		Elapsed:   10 * time.Second,
+		When:      now,
+	}
+	if sample != expected {
+		t.Fatalf("expected %+v, got %+v", expected, sample)
+	}
+
+	_, err = TakeNetworkSample("eth1", previous, current)
+	if err == nil {
+		t.Fatal("expected an error for a missing interface")
+	}
+
+	sample, err = TakeNetworkSample("eth0", NetworkSnapshot{When: previous.When}, current)
+	if err != nil || sample.Elapsed != 0 || sample.BytesIn != 0 {
+		t.Fatalf("expected no rates for a new interface, got %+v (%v)", sample, err)
+	}
+}
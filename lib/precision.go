@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Precision determines the number of decimal places that the
+// values of stats are rounded to, either per metric (by name)
+// or by default.
+type Precision struct {
+	Default int
+	Metrics map[string]int
+}
+
+// Places retrieves the number of decimal places of a metric.
+func (p Precision) Places(name string) int {
+	if places, found := p.Metrics[name]; found {
+		return places
+	}
+
+	return p.Default
+}
+
+// Round rounds the value of a stat (and the minimum and
+// maximum of its statistic set, if aggregated) to the
+// precision of its metric.
+//
+// The sum is kept as is: it's divided by the sample count to
+// compute averages, which rounding would skew.
+func (p Precision) Round(stat Stat) Stat {
+	var places = p.Places(stat.Name)
+
+	stat.Value = RoundPlus(stat.Value, places)
+	if stat.Statistics != nil {
+		var set = *stat.Statistics
+
+		set.Minimum = RoundPlus(set.Minimum, places)
+		set.Maximum = RoundPlus(set.Maximum, places)
+		stat.Statistics = &set
+	}
+
+	return stat
+}
+
+// PrecisionReporter implements the Reporter interface by
+// rounding the values of the stats before sending them to
+// another reporter.
+type PrecisionReporter struct {
+	reporter  Reporter
+	precision Precision
+}
+
+func NewPrecisionReporter(reporter Reporter, precision Precision) (precisionReporter *PrecisionReporter, err error) {
+	if precision.Default < 0 {
+		err = errors.Errorf("precision must not be negative (%d)", precision.Default)
+		return
+	}
+
+	for name, places := range precision.Metrics {
+		if places < 0 {
+			err = errors.Errorf("precision of %s must not be negative (%d)", name, places)
+			return
+		}
+	}
+
+	precisionReporter = &PrecisionReporter{
+		reporter:  reporter,
+		precision: precision,
+	}
+	return
+}
+
+func (r *PrecisionReporter) SendStat(stat Stat) (err error) {
+	err = r.reporter.SendStat(r.precision.Round(stat))
+	return
+}
+
+func (r *PrecisionReporter) Flush() (err error) {
+	err = r.reporter.Flush()
+	return
+}
+
+func (r *PrecisionReporter) Close() (err error) {
+	err = r.reporter.Close()
+	return
+}
@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestRoundPlus(t *testing.T) {
+	for _, tc := range []struct {
+		value    float64
+		places   int
+		expected float64
+	}{
+		{70.5, 2, 70.5},
+		{70.456, 2, 70.46},
+		{70.454, 2, 70.45},
+		{1.5, 0, 2},
+		{-1.5, 0, -2},
+		{-0.4, 0, 0},
+		{-70.456, 2, -70.46},
+		{-70.454, 2, -70.45},
+	} {
+		if actual := RoundPlus(tc.value, tc.places); actual != tc.expected {
+			t.Errorf("%f to %d places: expected %f, got %f", tc.value, tc.places, tc.expected, actual)
+		}
+	}
+}
+
+func TestPrecisionRound(t *testing.T) {
+	var precision = Precision{
+		Default: 2,
+		Metrics: map[string]int{
+			"LoadAvg1":      1,
+			"DiskReadBytes": 0,
+		},
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		stat     Stat
+		expected float64
+	}{
+		{
+			desc:     "default",
+			stat:     Stat{Name: "MemoryUtilization", Value: 70.456},
+			expected: 70.46,
+		},
+		{
+			desc:     "overridden",
+			stat:     Stat{Name: "LoadAvg1", Value: 1.26},
+			expected: 1.3,
+		},
+		{
+			desc:     "overridden to integers",
+			stat:     Stat{Name: "DiskReadBytes", Value: 1024.7},
+			expected: 1025,
+		},
+	} {
+		if actual := precision.Round(tc.stat).Value; actual != tc.expected {
+			t.Errorf("%s: expected %f, got %f", tc.desc, tc.expected, actual)
+		}
+	}
+}
+
+func TestPrecisionRoundKeepsSum(t *testing.T) {
+	var (
+		precision = Precision{Default: 0}
+		set       = &StatisticSet{
+			Minimum:     0.4,
+			Maximum:     0.6,
+			Sum:         1.5,
+			SampleCount: 3,
+		}
+		rounded = precision.Round(Stat{
+			Name:       "LoadAvg1",
+			Value:      0.5,
+			Statistics: set,
+		})
+	)
+
+	if rounded.Value != 1 {
+		t.Errorf("expected the value to be rounded, got %f", rounded.Value)
+	}
+
+	if rounded.Statistics.Minimum != 0 || rounded.Statistics.Maximum != 1 {
+		t.Errorf("expected the minimum and maximum to be rounded, got %+v", *rounded.Statistics)
+	}
+
+	if rounded.Statistics.Sum != 1.5 {
+		t.Errorf("expected the sum to be kept, got %f", rounded.Statistics.Sum)
+	}
+
+	if set.Minimum != 0.4 {
+		t.Error("expected the original statistic set to be left untouched")
+	}
+}
+
+func TestNewPrecisionReporterRejectsNegativePlaces(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		precision Precision
+	}{
+		{"default", Precision{Default: -1}},
+		{"metric", Precision{Metrics: map[string]int{"LoadAvg1": -1}}},
+	} {
+		if _, err := NewPrecisionReporter(&fakeReporter{}, tc.precision); err == nil {
+			t.Errorf("%s: expected negative places to be rejected", tc.desc)
+		}
+	}
+}
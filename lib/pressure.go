@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PressureStats holds the cumulative stall times of a resource
+// as reported by /proc/pressure/<resource>, in microseconds.
+//
+// `Some` accounts for the time in which at least one task was
+// stalled waiting for the resource and `Full` for the time in
+// which all of them were (not reported for cpu by kernels
+// older than 5.13).
+type PressureStats struct {
+	Resource string
+	Some     uint64
+	Full     uint64
+	HasFull  bool
+	When     time.Time
+}
+
+// PressureSample represents the percentage of time in which
+// tasks were stalled waiting for a resource between two reads
+// of its stall times.
+type PressureSample struct {
+	Resource string
+	Some     float64
+	Full     float64
+	HasFull  bool
+	When     time.Time
+}
+
+var (
+	pressureDirectory = "/proc/pressure"
+)
+
+// ReadPressureStats retrieves the stall times of a resource
+// (`cpu`, `memory` or `io`).
+func ReadPressureStats(resource string) (stats PressureStats, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(pressureDirectory, resource))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read %s pressure file", resource)
+		return
+	}
+
+	stats, err = parsePressure(resource, string(data))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse %s pressure", resource)
+		return
+	}
+
+	stats.When = time.Now()
+	return
+}
+
+// parsePressure parses the contents of a pressure file, which
+// looks like the following:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=2270716
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=1948284
+func parsePressure(resource, data string) (stats PressureStats, err error) {
+	stats.Resource = resource
+
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var total = strings.TrimPrefix(fields[len(fields)-1], "total=")
+		if total == fields[len(fields)-1] {
+			err = errors.Errorf("unexpected pressure line '%s'", line)
+			return
+		}
+
+		var value uint64
+		value, err = strconv.ParseUint(total, 10, 64)
+		if err != nil {
+			err = errors.Errorf("could not parse total '%s': %s", total, err)
+			return
+		}
+
+		switch fields[0] {
+		case "some":
+			stats.Some = value
+		case "full":
+			stats.Full = value
+			stats.HasFull = true
+		}
+	}
+
+	return
+}
+
+// TakePressureSample computes the percentage of time stalled
+// between the `previous` and the `current` stall times.
+func TakePressureSample(previous, current PressureStats) (sample PressureSample) {
+	sample.Resource = current.Resource
+	sample.HasFull = current.HasFull
+	sample.When = current.When
+
+	var micros = float64(current.When.Sub(previous.When) / time.Microsecond)
+	if micros <= 0 {
+		return
+	}
+
+	stalled := func(p, c uint64) float64 {
+		return float64(delta(p, c)) / micros * 100
+	}
+
+	sample.Some = stalled(previous.Some, current.Some)
+	sample.Full = stalled(previous.Full, current.Full)
+	return
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePressure(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		data     string
+		expected PressureStats
+		fails    bool
+	}{
+		{
+			desc: "some and full",
+			data: "some avg10=0.12 avg60=0.05 avg300=0.01 total=2270716\n" +
+				"full avg10=0.00 avg60=0.00 avg300=0.00 total=1948284\n",
+			expected: PressureStats{
+				Resource: "memory",
+				Some:     2270716,
+				Full:     1948284,
+				HasFull:  true,
+			},
+		},
+		{
+			desc: "cpu of kernels older than 5.13",
+			data: "some avg10=1.50 avg60=1.00 avg300=0.50 total=123456\n",
+			expected: PressureStats{
+				Resource: "memory",
+				Some:     123456,
+			},
+		},
+		{
+			desc:  "missing total",
+			data:  "some avg10=0.00 avg60=0.00 avg300=0.00\n",
+			fails: true,
+		},
+		{
+			desc:  "invalid total",
+			data:  "some avg10=0.00 avg60=0.00 avg300=0.00 total=-1\n",
+			fails: true,
+		},
+	} {
+		stats, err := parsePressure("memory", tc.data)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if stats != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, stats)
+		}
+	}
+}
+
+func TestTakePressureSample(t *testing.T) {
+	var (
+		now      = time.Now()
+		previous = PressureStats{Resource: "io", Some: 1000000, Full: 500000, When: now.Add(-10 * time.Second)}
+		current  = PressureStats{Resource: "io", Some: 3500000, Full: 1500000, HasFull: true, When: now}
+	)
+
+	var sample = TakePressureSample(previous, current)
+	if sample.Some != 25 || sample.Full != 10 || !sample.HasFull || sample.Resource != "io" {
+		t.Fatalf("expected 25%% some and 10%% full, got %+v", sample)
+	}
+
+	sample = TakePressureSample(current, current)
+	if sample.Some != 0 || sample.Full != 0 {
+		t.Fatalf("expected no pressure without time elapsed, got %+v", sample)
+	}
+}
@@ -0,0 +1,282 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clockTicks is the number of clock ticks per second (USER_HZ)
+// in which /proc/<pid>/stat expresses cpu times. It's 100 on
+// every architecture that Linux exposes to userspace.
+const clockTicks = 100
+
+// ProcessStats holds the information about a process as
+// reported by /proc/<pid>/stat and /proc/<pid>/status.
+type ProcessStats struct {
+	Pid   int
+	Name  string
+	State string
+
+	// CPUTime is the time spent in user and kernel mode
+	// and StartTime the time the process started after
+	// boot, both in clock ticks.
+	CPUTime   uint64
+	StartTime uint64
+
+	Threads uint64
+	RSS     uint64
+}
+
+// ProcessSnapshot holds the stats of all the processes
+// running at a given point in time.
+type ProcessSnapshot struct {
+	Processes []ProcessStats
+	When      time.Time
+}
+
+// ProcessSample represents the usage of all the processes
+// sharing a name between two snapshots.
+//
+// CPU is relative to a single core (a process that keeps
+// two cores busy uses 200%). OpenFiles is left for the caller
+// to fill given that counting them is relatively expensive.
+type ProcessSample struct {
+	Name      string
+	Pids      []int
+	CPU       float64
+	RSS       float64
+	Threads   float64
+	OpenFiles float64
+	When      time.Time
+}
+
+var (
+	procDirectory = "/proc"
+)
+
+// ReadProcessSnapshot walks /proc retrieving the stats of
+// every process.
+//
+// Processes that can't be read are skipped given that they
+// most likely exited while walking.
+func ReadProcessSnapshot() (snapshot ProcessSnapshot, err error) {
+	entries, err := ioutil.ReadDir(procDirectory)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't list processes")
+		return
+	}
+
+	snapshot.When = time.Now()
+	for _, entry := range entries {
+		pid, convErr := strconv.Atoi(entry.Name())
+		if convErr != nil || !entry.IsDir() {
+			continue
+		}
+
+		process, readErr := ReadProcessStats(pid)
+		if readErr != nil {
+			continue
+		}
+
+		snapshot.Processes = append(snapshot.Processes, process)
+	}
+
+	return
+}
+
+// ReadProcessStats retrieves the stats of a single process.
+func ReadProcessStats(pid int) (process ProcessStats, err error) {
+	var dir = filepath.Join(procDirectory, strconv.Itoa(pid))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read stat of process %d", pid)
+		return
+	}
+
+	process, err = parseProcessStat(string(data))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse stat of process %d", pid)
+		return
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read status of process %d", pid)
+		return
+	}
+
+	err = parseProcessStatus(string(data), &process)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse status of process %d", pid)
+		return
+	}
+
+	return
+}
+
+// parseProcessStat parses the contents of /proc/<pid>/stat.
+//
+// The name of the process (`comm`) is enclosed in parenthesis
+// and may itself contain spaces and parenthesis, so the fields
+// are only split after the last closing one.
+func parseProcessStat(data string) (process ProcessStats, err error) {
+	var (
+		start = strings.Index(data, "(")
+		end   = strings.LastIndex(data, ")")
+	)
+
+	if start == -1 || end < start {
+		err = errors.Errorf("unexpected stat '%s'", data)
+		return
+	}
+
+	process.Pid, err = strconv.Atoi(strings.TrimSpace(data[:start]))
+	if err != nil {
+		err = errors.Errorf("could not parse pid '%s': %s", data[:start], err)
+		return
+	}
+
+	process.Name = data[start+1 : end]
+
+	// fields start at the 3rd one (`state`) of proc(5).
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 20 {
+		err = errors.Errorf("unexpected stat '%s'", data)
+		return
+	}
+
+	var values = make([]uint64, 3)
+	for i, idx := range []int{11, 12, 19} { // utime, stime, starttime
+		values[i], err = strconv.ParseUint(fields[idx], 10, 64)
+		if err != nil {
+			err = errors.Errorf("could not parse field '%s': %s", fields[idx], err)
+			return
+		}
+	}
+
+	process.State = fields[0]
+	process.CPUTime = values[0] + values[1]
+	process.StartTime = values[2]
+	return
+}
+
+// parseProcessStatus parses the contents of /proc/<pid>/status
+// filling the thread count and the resident set size of the
+// process. Kernel threads have no `VmRSS`, leaving it at 0.
+func parseProcessStatus(data string, process *ProcessStats) (err error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "Threads:":
+			process.Threads, err = strconv.ParseUint(fields[1], 10, 64)
+		case "VmRSS:":
+			process.RSS, err = strconv.ParseUint(fields[1], 10, 64)
+			process.RSS *= 1024
+		default:
+			continue
+		}
+
+		if err != nil {
+			err = errors.Errorf("could not parse status line '%s': %s", line, err)
+			return
+		}
+	}
+
+	return
+}
+
+// ReadProcessCmdline retrieves the command line of a process,
+// with its arguments separated by spaces. It's empty for
+// kernel threads.
+func ReadProcessCmdline(pid int) (cmdline string, err error) {
+	data, err := ioutil.ReadFile(
+		filepath.Join(procDirectory, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read cmdline of process %d", pid)
+		return
+	}
+
+	cmdline = strings.Replace(
+		strings.TrimRight(string(data), "\x00"), "\x00", " ", -1)
+	return
+}
+
+// CountProcessFiles counts the file descriptors that a
+// process has open.
+func CountProcessFiles(pid int) (count int, err error) {
+	entries, err := ioutil.ReadDir(
+		filepath.Join(procDirectory, strconv.Itoa(pid), "fd"))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't list open files of process %d", pid)
+		return
+	}
+
+	count = len(entries)
+	return
+}
+
+// processKey identifies a process across snapshots, taking
+// into account that pids get reused.
+type processKey struct {
+	pid       int
+	startTime uint64
+}
+
+// TakeProcessSamples computes the usage of the processes in
+// the `current` snapshot grouped by name, sorted by name.
+//
+// The cpu usage covers the time since the `previous` snapshot;
+// processes that started in between are accounted for all of
+// their cpu time.
+func TakeProcessSamples(previous, current ProcessSnapshot) (samples []ProcessSample) {
+	var (
+		seconds = current.When.Sub(previous.When).Seconds()
+		prevCPU = make(map[processKey]uint64, len(previous.Processes))
+		groups  = make(map[string]*ProcessSample)
+	)
+
+	for _, process := range previous.Processes {
+		prevCPU[processKey{process.Pid, process.StartTime}] = process.CPUTime
+	}
+
+	for _, process := range current.Processes {
+		group, found := groups[process.Name]
+		if !found {
+			group = &ProcessSample{
+				Name: process.Name,
+				When: current.When,
+			}
+			groups[process.Name] = group
+		}
+
+		group.Pids = append(group.Pids, process.Pid)
+		group.RSS += float64(process.RSS)
+		group.Threads += float64(process.Threads)
+
+		if seconds > 0 {
+			ticks := delta(prevCPU[processKey{process.Pid, process.StartTime}], process.CPUTime)
+			group.CPU += float64(ticks) / clockTicks / seconds * 100
+		}
+	}
+
+	for _, group := range groups {
+		samples = append(samples, *group)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+
+	return
+}
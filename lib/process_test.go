@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestParseProcessStat(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		data     string
+		expected ProcessStats
+		fails    bool
+	}{
+		{
+			desc: "regular process",
+			data: "1234 (nginx) S 1 1234 1234 0 -1 4194624 1000 0 0 0 150 50 0 0 20 0 4 0 98765 123456789 2048 18446744073709551615\n",
+			expected: ProcessStats{
+				Pid:       1234,
+				Name:      "nginx",
+				State:     "S",
+				CPUTime:   200,
+				StartTime: 98765,
+			},
+		},
+		{
+			desc: "name with spaces and parenthesis",
+			data: "42 (tmux: server) (1)) R 1 42 42 0 -1 4194560 10 0 0 0 7 3 0 0 20 0 1 0 500 1000 100 18446744073709551615\n",
+			expected: ProcessStats{
+				Pid:       42,
+				Name:      "tmux: server) (1)",
+				State:     "R",
+				CPUTime:   10,
+				StartTime: 500,
+			},
+		},
+		{
+			desc:  "missing name",
+			data:  "1234 S 1 1234\n",
+			fails: true,
+		},
+		{
+			desc:  "truncated",
+			data:  "1234 (nginx) S 1 1234 1234\n",
+			fails: true,
+		},
+	} {
+		process, err := parseProcessStat(tc.data)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if process != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.desc, tc.expected, process)
+		}
+	}
+}
+
+func TestParseProcessStatus(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		data    string
+		threads uint64
+		rss     uint64
+		fails   bool
+	}{
+		{
+			desc:    "user process",
+			data:    "Name:\tnginx\nState:\tS (sleeping)\nVmRSS:\t    2048 kB\nThreads:\t4\n",
+			threads: 4,
+			rss:     2048 * 1024,
+		},
+		{
+			desc:    "kernel thread",
+			data:    "Name:\tkworker/0:1\nState:\tI (idle)\nThreads:\t1\n",
+			threads: 1,
+		},
+		{
+			desc:  "invalid threads",
+			data:  "Threads:\tmany\n",
+			fails: true,
+		},
+	} {
+		var process ProcessStats
+		err := parseProcessStatus(tc.data, &process)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.desc)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", tc.desc, err)
+			continue
+		}
+
+		if process.Threads != tc.threads || process.RSS != tc.rss {
+			t.Errorf("%s: expected %d threads and %d bytes, got %+v",
+				tc.desc, tc.threads, tc.rss, process)
+		}
+	}
+}
@@ -5,5 +5,16 @@ package lib
 type Reporter interface {
 
 	// SendStat sends the stat to a metrics collector.
+	// Implementations are free to buffer the stat until
+	// `Flush` gets called.
 	SendStat(stat Stat) (err error)
+
+	// Flush delivers any stat that has been buffered
+	// since the last flush (typically, those from a
+	// single collection cycle).
+	Flush() (err error)
+
+	// Close flushes the remaining stats and releases
+	// the resources held by the reporter.
+	Close() (err error)
 }
@@ -1,9 +1,16 @@
 package lib
 
 import (
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/pkg/errors"
@@ -11,35 +18,96 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// cwMaxDatumsPerRequest is the maximum number of
+	// datums that a single PutMetricData call accepts.
+	cwMaxDatumsPerRequest = 20
+
+	// cwMaxRequestSize is the maximum size (in bytes)
+	// of the body of a PutMetricData HTTP POST request.
+	cwMaxRequestSize = 40 * 1024
+
+	// cwMaxDatumAge is how far in the past the timestamp
+	// of a datum can be for CloudWatch to accept it.
+	cwMaxDatumAge = 14 * 24 * time.Hour
+
+	// cwHighResolution is the storage resolution (in seconds)
+	// of high-resolution metrics. Standard resolution metrics
+	// are stored with a 1 minute granularity.
+	cwHighResolution = 1
+
+	// cwMaxReplayedEntries is the number of spool entries
+	// replayed by a single flush so that draining the spool
+	// after a long outage doesn't hold up the collections.
+	cwMaxReplayedEntries = 5
+)
+
+// cloudWatchAPI is the subset of the CloudWatch API that the
+// reporter makes use of.
+type cloudWatchAPI interface {
+	PutMetricData(*cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error)
+}
+
 // CloudWatchReporter implements the Reporter interface
 // to provide the connection between samples generated
 // by the machine and CloudWatch.
 type CloudWatchReporter struct {
 	logger     zerolog.Logger
-	cw         *cloudwatch.CloudWatch
+	cw         cloudWatchAPI
 	dimensions []*cloudwatch.Dimension
 
+	mu      sync.Mutex
+	pending []Stat
+
+	flushMu sync.Mutex
+	spool   *Spool
+	backoff Backoff
+
 	namespace        string
 	autoscalingGroup string
 	instanceId       string
 	instanceType     string
 	aggregatedOnly   bool
+
+	highResolution        bool
+	highResolutionMetrics map[string]bool
 }
 
 // CloudWatchReporterConfig represents all the configuration
 // needed for initializing the cloudwatch reporter.
 // Note.: AutoScalingGroup is optional.
 type CloudWatchReporterConfig struct {
-	Debug bool
+	Debug bool `json:"debug"`
+
+	AccessKey        string `json:"access-key"`
+	SecretKey        string `json:"secret-key"`
+	AutoScalingGroup string `json:"autoscaling-group"`
+	InstanceId       string `json:"instance-id"`
+	InstanceType     string `json:"instance-type"`
+	Namespace        string `json:"namespace"`
+	Region           string `json:"region"`
+	AggregatedOnly   bool   `json:"aggregated-only"`
 
-	AccessKey        string
-	SecretKey        string
-	AutoScalingGroup string
-	InstanceId       string
-	InstanceType     string
-	Namespace        string
-	Region           string
-	AggregatedOnly   bool
+	// SpoolDirectory enables spooling stats that couldn't
+	// be delivered to a local directory so that they get
+	// replayed once CloudWatch can be reached again.
+	SpoolDirectory string `json:"spool-dir"`
+	SpoolMaxSize   int64  `json:"spool-max-size"`
+
+	// RetryInitialInterval and RetryMaxInterval bound the
+	// exponential backoff applied between delivery attempts
+	// once a delivery fails (only when spooling is enabled).
+	RetryInitialInterval time.Duration `json:"retry-initial-interval"`
+	RetryMaxInterval     time.Duration `json:"retry-max-interval"`
+
+	// HighResolution publishes every metric with a 1 second
+	// storage resolution while HighResolutionMetrics does so
+	// only for the metrics listed (by name). Both require
+	// Interval (how often stats are published) to be below
+	// a minute.
+	HighResolution        bool          `json:"high-resolution"`
+	HighResolutionMetrics []string      `json:"high-resolution-metrics"`
+	Interval              time.Duration `json:"-"`
 }
 
 func NewCloudWatchReporter(cfg CloudWatchReporterConfig) (reporter *CloudWatchReporter, err error) {
@@ -70,22 +138,10 @@ func NewCloudWatchReporter(cfg CloudWatchReporterConfig) (reporter *CloudWatchRe
 	}
 
 	if !instanceInfoSet {
-		var (
-			metaSession      *session.Session
-			instanceIdentity ec2metadata.EC2InstanceIdentityDocument
-		)
-
-		metaSession, err = session.NewSession(awsConfig)
-		if err != nil {
-			err = errors.Wrapf(err,
-				"failed creating aws session for retrieving ec2 metadata")
-			return
-		}
+		var instanceIdentity ec2metadata.EC2InstanceIdentityDocument
 
-		instanceIdentity, err = ec2metadata.New(metaSession).GetInstanceIdentityDocument()
+		instanceIdentity, err = fetchInstanceIdentity(awsConfig)
 		if err != nil {
-			err = errors.Wrapf(err,
-				"failed to retrieve instance metadata from AWS")
 			return
 		}
 
@@ -101,13 +157,56 @@ func NewCloudWatchReporter(cfg CloudWatchReporterConfig) (reporter *CloudWatchRe
 			cfg.AccessKey, cfg.SecretKey, "")
 	}
 
+	if cfg.HighResolution || len(cfg.HighResolutionMetrics) > 0 {
+		if cfg.Interval <= 0 || cfg.Interval >= time.Minute {
+			err = errors.Errorf(
+				"high-resolution metrics require publishing more often than once a minute (interval is %s)",
+				cfg.Interval)
+			return
+		}
+	}
+
 	reporter = &CloudWatchReporter{
 		instanceId:       cfg.InstanceId,
 		instanceType:     cfg.InstanceType,
 		autoscalingGroup: cfg.AutoScalingGroup,
 		namespace:        cfg.Namespace,
 		aggregatedOnly:   cfg.AggregatedOnly,
+		highResolution:   cfg.HighResolution,
 		logger:           log.With().Str("from", "reporter_cw").Logger(),
+		backoff: Backoff{
+			Initial: cfg.RetryInitialInterval,
+			Max:     cfg.RetryMaxInterval,
+		},
+	}
+
+	if len(cfg.HighResolutionMetrics) > 0 {
+		reporter.highResolutionMetrics = make(map[string]bool)
+		for _, name := range cfg.HighResolutionMetrics {
+			reporter.highResolutionMetrics[name] = true
+		}
+	}
+
+	if cfg.HighResolution || len(cfg.HighResolutionMetrics) > 0 {
+		reporter.logger.Warn().
+			Bool("all", cfg.HighResolution).
+			Strs("metrics", cfg.HighResolutionMetrics).
+			Dur("interval", cfg.Interval).
+			Msg("high-resolution metrics enabled: publishing often means more (billed) " +
+				"PutMetricData requests and alarms on them are charged at the high-resolution rate")
+	}
+
+	if cfg.SpoolDirectory != "" {
+		reporter.spool, err = NewSpool(SpoolConfig{
+			Directory: cfg.SpoolDirectory,
+			MaxSize:   cfg.SpoolMaxSize,
+			MaxAge:    cwMaxDatumAge,
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't create spool for undelivered metrics.")
+			return
+		}
 	}
 
 	sess, err := session.NewSession(awsConfig)
@@ -118,75 +217,455 @@ func NewCloudWatchReporter(cfg CloudWatchReporterConfig) (reporter *CloudWatchRe
 	}
 
 	reporter.cw = cloudwatch.New(sess)
-	reporter.dimensions = make([]*cloudwatch.Dimension, 0)
-	if !cfg.AggregatedOnly {
-		reporter.dimensions = append(
-			reporter.dimensions, &cloudwatch.Dimension{
+	reporter.dimensions = newCloudWatchDimensions(
+		reporter.instanceType, reporter.instanceId,
+		reporter.autoscalingGroup, reporter.aggregatedOnly)
+
+	reporter.logger.Debug().
+		Interface("reporter", reporter).
+		Msg("reporter created")
+
+	return
+}
+
+// fetchInstanceIdentity retrieves the identity document of
+// the instance from the EC2 metadata service.
+func fetchInstanceIdentity(awsConfig *aws.Config) (instanceIdentity ec2metadata.EC2InstanceIdentityDocument, err error) {
+	metaSession, err := session.NewSession(awsConfig)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed creating aws session for retrieving ec2 metadata")
+		return
+	}
+
+	instanceIdentity, err = ec2metadata.New(metaSession).GetInstanceIdentityDocument()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to retrieve instance metadata from AWS")
+		return
+	}
+
+	return
+}
+
+// newCloudWatchDimensions builds the dimensions attached to
+// every datum: the instance type, id and autoscaling group
+// (if any), or only the autoscaling group when reporting
+// aggregated metrics.
+func newCloudWatchDimensions(instanceType, instanceId, autoscalingGroup string, aggregatedOnly bool) (dimensions []*cloudwatch.Dimension) {
+	dimensions = make([]*cloudwatch.Dimension, 0)
+	if !aggregatedOnly {
+		dimensions = append(
+			dimensions, &cloudwatch.Dimension{
 				Name:  aws.String("InstanceType"),
-				Value: aws.String(reporter.instanceType),
+				Value: aws.String(instanceType),
 			})
 
-		reporter.dimensions = append(
-			reporter.dimensions, &cloudwatch.Dimension{
+		dimensions = append(
+			dimensions, &cloudwatch.Dimension{
 				Name:  aws.String("InstanceId"),
-				Value: aws.String(reporter.instanceId),
+				Value: aws.String(instanceId),
 			})
 
-		if reporter.autoscalingGroup != "" {
-			reporter.dimensions = append(
-				reporter.dimensions, &cloudwatch.Dimension{
+		if autoscalingGroup != "" {
+			dimensions = append(
+				dimensions, &cloudwatch.Dimension{
 					Name:  aws.String("AutoScalingGroupName"),
-					Value: aws.String(reporter.autoscalingGroup),
+					Value: aws.String(autoscalingGroup),
 				})
 		}
 	} else {
-		reporter.dimensions = append(
-			reporter.dimensions, &cloudwatch.Dimension{
+		dimensions = append(
+			dimensions, &cloudwatch.Dimension{
 				Name:  aws.String("AutoScalingGroupName"),
-				Value: aws.String(reporter.autoscalingGroup),
+				Value: aws.String(autoscalingGroup),
 			})
 	}
 
-	reporter.logger.Debug().
-		Interface("reporter", reporter).
-		Msg("reporter created")
-
 	return
 }
 
+// SendStat buffers the stat until the next call to `Flush`.
 func (reporter *CloudWatchReporter) SendStat(stat Stat) (err error) {
 	reporter.logger.Debug().
 		Interface("stat", stat).
-		Msg("sending stat")
+		Msg("buffering stat")
+
+	reporter.mu.Lock()
+	reporter.pending = append(reporter.pending, stat)
+	reporter.mu.Unlock()
+
+	return
+}
+
+// Flush sends all the buffered stats to CloudWatch using
+// as few PutMetricData calls as the API limits allow.
+//
+// When spooling is enabled, stats that fail to be delivered
+// are spooled and further attempts are delayed with an
+// exponential backoff (flushes keep failing meanwhile). Once
+// delivery succeeds again, the spooled stats are replayed with
+// their original timestamps, a few entries per flush. Stats
+// that CloudWatch rejects as invalid are dropped rather than
+// spooled given that retrying them can't succeed.
+func (reporter *CloudWatchReporter) Flush() (err error) {
+	reporter.mu.Lock()
+	var stats = reporter.pending
+	reporter.pending = nil
+	reporter.mu.Unlock()
+
+	reporter.flushMu.Lock()
+	defer reporter.flushMu.Unlock()
+
+	if reporter.spool == nil {
+		_, err = reporter.send(stats)
+		return
+	}
 
-	var extraDimensions = make([]*cloudwatch.Dimension, 0)
+	var now = time.Now()
+	if !reporter.backoff.Ready(now) {
+		reporter.logger.Debug().
+			Int("stats", len(stats)).
+			Msg("delivery backing off, spooling stats")
+
+		err = reporter.spool.Push(stats)
+		if err != nil {
+			return
+		}
+
+		err = errors.Errorf(
+			"CloudWatch delivery backing off, %d stats spooled.", len(stats))
+		return
+	}
+
+	failed, err := reporter.send(stats)
+	if len(failed) > 0 {
+		reporter.backOff(now)
+		pushErr := reporter.spool.Push(failed)
+		if pushErr != nil {
+			reporter.logger.Error().
+				Err(pushErr).
+				Int("stats", len(failed)).
+				Msg("failed to spool stats")
+		}
+		return
+	}
+
+	reporter.backoff.Success()
+
+	replayErr := reporter.replaySpool()
+	if replayErr != nil {
+		reporter.backOff(now)
+		if err == nil {
+			err = replayErr
+		}
+		return
+	}
+
+	return
+}
+
+// Close flushes the stats that are still buffered.
+func (reporter *CloudWatchReporter) Close() (err error) {
+	err = reporter.Flush()
+	return
+}
+
+// backOff records a failed delivery, delaying the next one.
+func (reporter *CloudWatchReporter) backOff(now time.Time) {
+	delay := reporter.backoff.Failure(now)
+	reporter.logger.Warn().
+		Dur("retry-in", delay).
+		Msg("delivery failed, backing off")
+}
+
+// replaySpool delivers up to `cwMaxReplayedEntries` spooled
+// entries (oldest first), stopping at the first one that
+// fails to be delivered.
+//
+// Entries are removed once sent. When some of their batches
+// fail, the entry is rewritten in place with the stats of
+// those batches so that it keeps its turn (and gets evicted
+// first if the spool fills up).
+func (reporter *CloudWatchReporter) replaySpool() (err error) {
+	entries, err := reporter.spool.Entries()
+	if err != nil {
+		return
+	}
+
+	if len(entries) > cwMaxReplayedEntries {
+		entries = entries[:cwMaxReplayedEntries]
+	}
+
+	for _, entry := range entries {
+		stats, readErr := reporter.spool.Read(entry)
+		if readErr != nil {
+			reporter.logger.Error().
+				Err(readErr).
+				Str("entry", entry).
+				Msg("discarding unreadable spool entry")
+
+			err = reporter.spool.Remove(entry)
+			if err != nil {
+				return
+			}
+
+			continue
+		}
+
+		failed, sendErr := reporter.send(stats)
+
+		err = reporter.spool.Replace(entry, failed)
+		if err != nil {
+			return
+		}
+
+		if len(failed) > 0 {
+			err = errors.Wrapf(sendErr,
+				"Errored replaying spooled metrics.")
+			return
+		}
+
+		reporter.logger.Info().
+			Str("entry", entry).
+			Int("stats", len(stats)).
+			Msg("spooled stats delivered")
+	}
+
+	return
+}
+
+// send delivers a list of stats to CloudWatch in batches.
+//
+// Batches are sent independently: a failing batch doesn't
+// prevent the others from being delivered. The stats from the
+// batches that failed and are worth retrying are returned
+// along with an error that aggregates the failures; those of
+// the batches that got rejected are dropped.
+func (reporter *CloudWatchReporter) send(stats []Stat) (failed []Stat, err error) {
+	if len(stats) == 0 {
+		return
+	}
+
+	var (
+		batches       = batchStats(reporter.namespace, stats, reporter.newDatum)
+		failedBatches = 0
+	)
+
+	for idx, batch := range batches {
+		var datums = make([]*cloudwatch.MetricDatum, 0, len(batch))
+		for _, entry := range batch {
+			datums = append(datums, entry.datum)
+		}
+
+		_, batchErr := reporter.cw.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(reporter.namespace),
+			MetricData: datums,
+		})
+		if batchErr != nil {
+			failedBatches++
+
+			if isPermanentCloudWatchError(batchErr) {
+				reporter.logger.Error().
+					Err(batchErr).
+					Int("batch", idx).
+					Int("datums", len(batch)).
+					Msg("batch rejected, dropping it")
+				continue
+			}
+
+			for _, entry := range batch {
+				failed = append(failed, entry.stat)
+			}
+
+			reporter.logger.Error().
+				Err(batchErr).
+				Int("batch", idx).
+				Int("datums", len(batch)).
+				Msg("failed to send batch")
+			continue
+		}
+
+		reporter.logger.Debug().
+			Int("batch", idx).
+			Int("datums", len(batch)).
+			Msg("batch sent")
+	}
+
+	if failedBatches > 0 {
+		err = errors.Errorf(
+			"Errored sending %d out of %d batches of metrics to cloudwatch.",
+			failedBatches, len(batches))
+		return
+	}
+
+	return
+}
+
+// isPermanentCloudWatchError indicates whether a failed request
+// got rejected for reasons that retrying can't fix (e.g., an
+// InvalidParameterValue), i.e., a 4xx response other than
+// throttling or expired credentials.
+func isPermanentCloudWatchError(err error) bool {
+	reqErr, ok := err.(awserr.RequestFailure)
+	if !ok {
+		return false
+	}
+
+	if request.IsErrorThrottle(err) || request.IsErrorRetryable(err) ||
+		request.IsErrorExpiredCreds(err) {
+		return false
+	}
+
+	return reqErr.StatusCode() >= 400 && reqErr.StatusCode() < 500 &&
+		reqErr.StatusCode() != 429
+}
+
+// newDatum creates a CloudWatch datum out of a stat, attaching
+// the reporter dimensions as well as the stat-specific ones.
+//
+// Aggregated stats are sent as statistic sets and the ones
+// configured as high-resolution get a 1 second storage
+// resolution.
+func (reporter *CloudWatchReporter) newDatum(stat Stat) (datum *cloudwatch.MetricDatum) {
+	var dimensions = make([]*cloudwatch.Dimension, 0,
+		len(reporter.dimensions)+len(stat.ExtraDimensions))
+
+	dimensions = append(dimensions, reporter.dimensions...)
 	for k, v := range stat.ExtraDimensions {
-		extraDimensions = append(extraDimensions, &cloudwatch.Dimension{
+		dimensions = append(dimensions, &cloudwatch.Dimension{
 			Name:  aws.String(k),
 			Value: aws.String(v),
 		})
 	}
 
-	var datum = cloudwatch.MetricDatum{
+	datum = &cloudwatch.MetricDatum{
 		MetricName: aws.String(stat.Name),
 		Timestamp:  aws.Time(stat.When),
 		Unit:       aws.String(stat.Unit),
-		Dimensions: append(reporter.dimensions, extraDimensions...),
-		Value:      aws.Float64(stat.Value),
+		Dimensions: dimensions,
 	}
 
-	var input = cloudwatch.PutMetricDataInput{
-		Namespace: aws.String(reporter.namespace),
-		MetricData: []*cloudwatch.MetricDatum{
-			&datum,
-		},
+	if reporter.highResolution || reporter.highResolutionMetrics[stat.Name] {
+		datum.StorageResolution = aws.Int64(cwHighResolution)
 	}
 
-	_, err = reporter.cw.PutMetricData(&input)
-	if err != nil {
-		err = errors.Wrapf(err,
-			"Errored sending metric to cloudwatch.")
-		return
+	if stat.Statistics != nil {
+		datum.StatisticValues = &cloudwatch.StatisticSet{
+			Minimum:     aws.Float64(stat.Statistics.Minimum),
+			Maximum:     aws.Float64(stat.Statistics.Maximum),
+			Sum:         aws.Float64(stat.Statistics.Sum),
+			SampleCount: aws.Float64(stat.Statistics.SampleCount),
+		}
+	} else {
+		datum.Value = aws.Float64(stat.Value)
+	}
+
+	return
+}
+
+// cwBatchEntry pairs a stat with the datum it's been
+// converted to.
+type cwBatchEntry struct {
+	stat  Stat
+	datum *cloudwatch.MetricDatum
+}
+
+// batchStats converts a list of stats into datums and splits
+// them into batches that respect both the maximum number of
+// datums per request and the maximum request size.
+func batchStats(namespace string, stats []Stat, newDatum func(Stat) *cloudwatch.MetricDatum) (batches [][]cwBatchEntry) {
+	var (
+		baseSize = estimateRequestBaseSize(namespace)
+		batch    []cwBatchEntry
+		size     = baseSize
+	)
+
+	for _, stat := range stats {
+		var (
+			datum     = newDatum(stat)
+			datumSize = estimateDatumSize(datum)
+		)
+
+		if len(batch) > 0 &&
+			(len(batch) == cwMaxDatumsPerRequest || size+datumSize > cwMaxRequestSize) {
+			batches = append(batches, batch)
+			batch = nil
+			size = baseSize
+		}
+
+		batch = append(batch, cwBatchEntry{
+			stat:  stat,
+			datum: datum,
+		})
+		size += datumSize
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return
+}
+
+// estimateRequestBaseSize estimates the size of the
+// form-encoded parameters that every PutMetricData request
+// carries regardless of its datums.
+func estimateRequestBaseSize(namespace string) int {
+	return len("Action=PutMetricData&Version=2010-08-01&Namespace=") +
+		len(url.QueryEscape(namespace))
+}
+
+// estimateDatumSize estimates the size that a datum takes
+// once form-encoded in the body of a PutMetricData request.
+//
+// It's a slight overestimation given that member indexes are
+// assumed to take the maximum number of digits.
+func estimateDatumSize(datum *cloudwatch.MetricDatum) (size int) {
+	const memberPrefix = "&MetricData.member.NN."
+
+	param := func(key, value string) int {
+		return len(memberPrefix) + len(key) + 1 + len(url.QueryEscape(value))
+	}
+
+	size += param("MetricName", aws.StringValue(datum.MetricName))
+	size += param("Unit", aws.StringValue(datum.Unit))
+	size += param("Timestamp",
+		aws.TimeValue(datum.Timestamp).UTC().Format(time.RFC3339Nano))
+
+	if datum.StorageResolution != nil {
+		size += param("StorageResolution",
+			strconv.FormatInt(*datum.StorageResolution, 10))
+	}
+
+	if datum.Value != nil {
+		size += param("Value",
+			strconv.FormatFloat(*datum.Value, 'f', -1, 64))
+	}
+
+	if set := datum.StatisticValues; set != nil {
+		for key, value := range map[string]*float64{
+			"StatisticValues.Minimum":     set.Minimum,
+			"StatisticValues.Maximum":     set.Maximum,
+			"StatisticValues.Sum":         set.Sum,
+			"StatisticValues.SampleCount": set.SampleCount,
+		} {
+			size += param(key,
+				strconv.FormatFloat(aws.Float64Value(value), 'f', -1, 64))
+		}
+	}
+
+	// an empty list of dimensions still gets encoded as an
+	// empty parameter.
+	if len(datum.Dimensions) == 0 {
+		size += param("Dimensions", "")
+	}
+
+	for _, dimension := range datum.Dimensions {
+		size += param("Dimensions.member.NN.Name",
+			aws.StringValue(dimension.Name))
+		size += param("Dimensions.member.NN.Value",
+			aws.StringValue(dimension.Value))
 	}
 
 	return
@@ -0,0 +1,492 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/query/queryutil"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/rs/zerolog"
+)
+
+// fakeCloudWatch records the metrics of the PutMetricData
+// calls that succeed, failing the calls for which an error
+// has been queued.
+type fakeCloudWatch struct {
+	errs []error
+	sent []string
+}
+
+func (f *fakeCloudWatch) PutMetricData(input *cloudwatch.PutMetricDataInput) (output *cloudwatch.PutMetricDataOutput, err error) {
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+		if err != nil {
+			return
+		}
+	}
+
+	for _, datum := range input.MetricData {
+		f.sent = append(f.sent, aws.StringValue(datum.MetricName))
+	}
+
+	output = &cloudwatch.PutMetricDataOutput{}
+	return
+}
+
+var (
+	cwUnavailable = awserr.NewRequestFailure(
+		awserr.New("ServiceUnavailable", "unavailable", nil), 503, "")
+	cwThrottled = awserr.NewRequestFailure(
+		awserr.New("Throttling", "rate exceeded", nil), 400, "")
+	cwInvalid = awserr.NewRequestFailure(
+		awserr.New("InvalidParameterValue", "invalid value", nil), 400, "")
+)
+
+func flushStats(reporter *CloudWatchReporter, names ...string) error {
+	for _, stat := range spoolStats(names...) {
+		reporter.SendStat(stat)
+	}
+
+	return reporter.Flush()
+}
+
+func TestCloudWatchReporterReplaysInOrder(t *testing.T) {
+	var cw = &fakeCloudWatch{
+		errs: []error{
+			cwUnavailable, // a
+			cwUnavailable, // b
+			nil,           // c
+			cwUnavailable, // replay of a
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reporter = &CloudWatchReporter{
+		logger:    zerolog.Nop(),
+		cw:        cw,
+		spool:     spool,
+		namespace: "test",
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if err := flushStats(reporter, name); err == nil {
+			t.Fatalf("expected flush of %s to fail", name)
+		}
+	}
+
+	if err := flushStats(reporter, "c"); err == nil {
+		t.Fatal("expected the replay to fail")
+	}
+
+	if names := readSpool(t, reporter.spool); !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("expected the failed replay to keep its place, got %v", names)
+	}
+
+	if err := flushStats(reporter, "d"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cw.sent, []string{"c", "d", "a", "b"}) {
+		t.Fatalf("expected spooled stats to be replayed oldest first, got %v", cw.sent)
+	}
+
+	if names := readSpool(t, reporter.spool); len(names) != 0 {
+		t.Fatalf("expected an empty spool, got %v", names)
+	}
+}
+
+func TestCloudWatchReporterDropsRejectedBatches(t *testing.T) {
+	var cw = &fakeCloudWatch{
+		errs: []error{cwInvalid},
+	}
+
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reporter = &CloudWatchReporter{
+		logger:    zerolog.Nop(),
+		cw:        cw,
+		spool:     spool,
+		namespace: "test",
+	}
+
+	if err := flushStats(reporter, "invalid"); err == nil {
+		t.Fatal("expected the rejection to be reported")
+	}
+
+	if names := readSpool(t, reporter.spool); len(names) != 0 {
+		t.Fatalf("expected rejected stats not to be spooled, got %v", names)
+	}
+
+	if !reporter.backoff.next.IsZero() {
+		t.Fatal("expected a rejection not to delay further deliveries")
+	}
+}
+
+func TestIsPermanentCloudWatchError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		permanent bool
+	}{
+		{cwInvalid, true},
+		{cwUnavailable, false},
+		{cwThrottled, false},
+		{awserr.NewRequestFailure(
+			awserr.New("ExpiredToken", "expired", nil), 403, ""), false},
+		{awserr.NewRequestFailure(
+			awserr.New("TooManyRequests", "", nil), 429, ""), false},
+		{awserr.New("RequestError", "send request failed", nil), false},
+	} {
+		if permanent := isPermanentCloudWatchError(tc.err); permanent != tc.permanent {
+			t.Errorf("%s: expected permanent=%t, got %t", tc.err, tc.permanent, permanent)
+		}
+	}
+}
+
+func TestCloudWatchReporterFailsWhileBackingOff(t *testing.T) {
+	var cw = &fakeCloudWatch{
+		errs: []error{cwUnavailable},
+	}
+
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reporter = &CloudWatchReporter{
+		logger:    zerolog.Nop(),
+		cw:        cw,
+		spool:     spool,
+		namespace: "test",
+		backoff: Backoff{
+			Initial: time.Hour,
+		},
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := flushStats(reporter, name); err == nil {
+			t.Fatalf("expected flush of %s to fail during the outage", name)
+		}
+	}
+
+	if len(cw.sent) != 0 || len(cw.errs) != 0 {
+		t.Fatalf("expected a single delivery attempt, got %v sent", cw.sent)
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Fatalf("expected every stat to be spooled, got %v", names)
+	}
+}
+
+func TestCloudWatchReporterReplaysFewEntriesPerFlush(t *testing.T) {
+	var cw = &fakeCloudWatch{}
+
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reporter = &CloudWatchReporter{
+		logger:    zerolog.Nop(),
+		cw:        cw,
+		spool:     spool,
+		namespace: "test",
+	}
+
+	for i := 0; i < cwMaxReplayedEntries+2; i++ {
+		if err := spool.Push(spoolStats("spooled")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := flushStats(reporter, "fresh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cw.sent) != cwMaxReplayedEntries+1 {
+		t.Fatalf("expected %d entries to be replayed, got %v", cwMaxReplayedEntries, cw.sent)
+	}
+
+	if names := readSpool(t, spool); len(names) != 2 {
+		t.Fatalf("expected 2 entries left for the next flush, got %v", names)
+	}
+
+	if err := flushStats(reporter); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := readSpool(t, spool); len(names) != 0 {
+		t.Fatalf("expected the spool to be drained, got %v", names)
+	}
+}
+
+// encodedRequestSize is the size of the body of the
+// PutMetricData request that the SDK builds out of a batch.
+func encodedRequestSize(t *testing.T, namespace string, batch []cwBatchEntry) int {
+	var input = &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(namespace),
+	}
+	for _, entry := range batch {
+		input.MetricData = append(input.MetricData, entry.datum)
+	}
+
+	var body = url.Values{
+		"Action":  {"PutMetricData"},
+		"Version": {"2010-08-01"},
+	}
+	if err := queryutil.Parse(body, input, false); err != nil {
+		t.Fatal(err)
+	}
+
+	return len(body.Encode())
+}
+
+func TestBatchStats(t *testing.T) {
+	var (
+		reporter = &CloudWatchReporter{namespace: "System/Linux"}
+		when     = time.Unix(1500000000, 123)
+		large    = map[string]string{}
+	)
+
+	for i := 0; i < 10; i++ {
+		large[fmt.Sprintf("Dimension%d", i)] = strings.Repeat("/mnt/a b", 31)
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		stats      int
+		dimensions map[string]string
+		statistics *StatisticSet
+		batches    []int
+	}{
+		{
+			desc:    "fits a single batch",
+			stats:   cwMaxDatumsPerRequest,
+			batches: []int{20},
+		},
+		{
+			desc:    "more datums than a request takes",
+			stats:   2*cwMaxDatumsPerRequest + 5,
+			batches: []int{20, 20, 5},
+		},
+		{
+			desc:       "large dimension sets",
+			stats:      cwMaxDatumsPerRequest,
+			dimensions: large,
+			batches:    []int{8, 8, 4},
+		},
+		{
+			desc:       "large aggregated dimension sets",
+			stats:      cwMaxDatumsPerRequest,
+			dimensions: large,
+			statistics: &StatisticSet{
+				Minimum:     0.123456789,
+				Maximum:     123456.789,
+				Sum:         1234567.891,
+				SampleCount: 10,
+			},
+			batches: []int{7, 7, 6},
+		},
+	} {
+		var stats []Stat
+		for i := 0; i < tc.stats; i++ {
+			stats = append(stats, Stat{
+				Name:            fmt.Sprintf("Metric%d", i),
+				Unit:            "Percent",
+				Value:           float64(i) / 3,
+				When:            when,
+				ExtraDimensions: tc.dimensions,
+				Statistics:      tc.statistics,
+			})
+		}
+
+		var (
+			batches = batchStats(reporter.namespace, stats, reporter.newDatum)
+			sizes   []int
+		)
+
+		for _, batch := range batches {
+			sizes = append(sizes, len(batch))
+
+			var (
+				encoded   = encodedRequestSize(t, reporter.namespace, batch)
+				estimated = estimateRequestBaseSize(reporter.namespace)
+			)
+			for _, entry := range batch {
+				estimated += estimateDatumSize(entry.datum)
+			}
+
+			if encoded > cwMaxRequestSize {
+				t.Errorf("%s: expected batches of at most %d bytes, got %d", tc.desc, cwMaxRequestSize, encoded)
+			}
+
+			if estimated < encoded {
+				t.Errorf("%s: expected the estimation (%d) not to be below the request size (%d)", tc.desc, estimated, encoded)
+			}
+		}
+
+		if !reflect.DeepEqual(sizes, tc.batches) {
+			t.Errorf("%s: expected batches of %v datums, got %v", tc.desc, tc.batches, sizes)
+		}
+	}
+}
+
+func TestCloudWatchReporterReportsFailedBatches(t *testing.T) {
+	var cw = &fakeCloudWatch{
+		errs: []error{nil, cwUnavailable, nil},
+	}
+
+	var reporter = &CloudWatchReporter{
+		logger:    zerolog.Nop(),
+		cw:        cw,
+		namespace: "test",
+	}
+
+	var names []string
+	for i := 0; i < 2*cwMaxDatumsPerRequest+5; i++ {
+		names = append(names, fmt.Sprintf("Metric%d", i))
+	}
+
+	failed, err := reporter.send(spoolStats(names...))
+	if err == nil || !strings.Contains(err.Error(), "1 out of 3 batches") {
+		t.Fatalf("expected a single failed batch to be reported, got %v", err)
+	}
+
+	if len(failed) != cwMaxDatumsPerRequest || failed[0].Name != names[cwMaxDatumsPerRequest] {
+		t.Fatalf("expected the stats of the second batch to be returned, got %d stats", len(failed))
+	}
+
+	if len(cw.sent) != cwMaxDatumsPerRequest+5 {
+		t.Fatalf("expected the other batches to be sent, got %d datums", len(cw.sent))
+	}
+}
+
+func TestNewCloudWatchReporterHighResolutionInterval(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		all      bool
+		metrics  []string
+		interval time.Duration
+		valid    bool
+	}{
+		{desc: "standard resolution", interval: time.Minute, valid: true},
+		{desc: "all metrics", all: true, interval: 10 * time.Second, valid: true},
+		{desc: "some metrics", metrics: []string{"MemoryUtilization"}, interval: 59 * time.Second, valid: true},
+		{desc: "all metrics every minute", all: true, interval: time.Minute},
+		{desc: "some metrics every 5 minutes", metrics: []string{"MemoryUtilization"}, interval: 5 * time.Minute},
+		{desc: "unknown interval", all: true},
+	} {
+		_, err := NewCloudWatchReporter(CloudWatchReporterConfig{
+			InstanceId:            "i-123",
+			InstanceType:          "t2.micro",
+			Region:                "us-east-1",
+			AccessKey:             "key",
+			SecretKey:             "secret",
+			Namespace:             "System/Linux",
+			HighResolution:        tc.all,
+			HighResolutionMetrics: tc.metrics,
+			Interval:              tc.interval,
+		})
+
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", tc.desc, err)
+		}
+
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected the interval to be rejected", tc.desc)
+		}
+	}
+}
+
+func TestCloudWatchReporterStorageResolution(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		reporter *CloudWatchReporter
+		expected map[string]bool
+	}{
+		{
+			desc:     "standard resolution",
+			reporter: &CloudWatchReporter{},
+			expected: map[string]bool{"MemoryUtilization": false, "DiskUtilization": false},
+		},
+		{
+			desc:     "all metrics",
+			reporter: &CloudWatchReporter{highResolution: true},
+			expected: map[string]bool{"MemoryUtilization": true, "DiskUtilization": true},
+		},
+		{
+			desc: "some metrics",
+			reporter: &CloudWatchReporter{
+				highResolutionMetrics: map[string]bool{"MemoryUtilization": true},
+			},
+			expected: map[string]bool{"MemoryUtilization": true, "DiskUtilization": false},
+		},
+	} {
+		for name, high := range tc.expected {
+			var datum = tc.reporter.newDatum(Stat{Name: name, Value: 1})
+
+			if !high && datum.StorageResolution != nil {
+				t.Errorf("%s: expected %s not to set a storage resolution", tc.desc, name)
+			}
+
+			if high && aws.Int64Value(datum.StorageResolution) != cwHighResolution {
+				t.Errorf("%s: expected %s to have a 1 second resolution, got %v",
+					tc.desc, name, datum.StorageResolution)
+			}
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// EMFReporter implements the Reporter interface by emitting
+// stats as CloudWatch Embedded Metric Format (EMF) documents
+// to stdout, a file or a local TCP/UDP socket (e.g., the one
+// of the CloudWatch agent), so that metrics get extracted from
+// logs instead of being sent via PutMetricData.
+type EMFReporter struct {
+	logger     zerolog.Logger
+	cfg        EMFReporterConfig
+	dimensions []emfDimension
+
+	mu      sync.Mutex
+	pending [][]byte
+	out     io.WriteCloser
+}
+
+// EMFReporterConfig represents all the configuration needed
+// for initializing the EMF reporter.
+//
+// The namespace and dimensions follow the ones from the
+// CloudWatch reporter.
+type EMFReporterConfig struct {
+	AutoScalingGroup string `json:"autoscaling-group"`
+	InstanceId       string `json:"instance-id"`
+	InstanceType     string `json:"instance-type"`
+	Namespace        string `json:"namespace"`
+	AggregatedOnly   bool   `json:"aggregated-only"`
+
+	// Output is one of `stdout` (default), `file`, `tcp`
+	// or `udp`.
+	Output string `json:"output"`
+
+	// Path is the file written to when Output is `file`.
+	Path string `json:"path"`
+
+	// Address is the `host:port` documents are sent to when
+	// Output is `tcp` or `udp`.
+	Address string `json:"address"`
+}
+
+type emfDimension struct {
+	name  string
+	value string
+}
+
+// emfMetadata is the `_aws` member of an EMF document.
+type emfMetadata struct {
+	Timestamp         int64                `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricDirective `json:"CloudWatchMetrics"`
+}
+
+type emfMetricDirective struct {
+	Namespace  string          `json:"Namespace"`
+	Dimensions [][]string      `json:"Dimensions"`
+	Metrics    []emfMetricInfo `json:"Metrics"`
+}
+
+type emfMetricInfo struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// emfStatisticSet is the value of a metric that aggregates
+// several samples.
+type emfStatisticSet struct {
+	Max   float64 `json:"Max"`
+	Min   float64 `json:"Min"`
+	Sum   float64 `json:"Sum"`
+	Count float64 `json:"Count"`
+}
+
+func NewEMFReporter(cfg EMFReporterConfig) (reporter *EMFReporter, err error) {
+	if cfg.Namespace == "" {
+		err = errors.Errorf("A CloudWatch Namespace must be provided")
+		return
+	}
+
+	if cfg.AggregatedOnly && cfg.AutoScalingGroup == "" {
+		err = errors.Errorf("aggregatedOnly mode requires autoscaling group.")
+		return
+	}
+
+	if !cfg.AggregatedOnly && (cfg.InstanceId == "" || cfg.InstanceType == "") {
+		var instanceIdentity ec2metadata.EC2InstanceIdentityDocument
+
+		instanceIdentity, err = fetchInstanceIdentity(&aws.Config{})
+		if err != nil {
+			return
+		}
+
+		cfg.InstanceType = instanceIdentity.InstanceType
+		cfg.InstanceId = instanceIdentity.InstanceID
+	}
+
+	reporter = &EMFReporter{
+		cfg: cfg,
+		logger: log.With().
+			Str("from", "reporter_emf").
+			Str("output", cfg.Output).
+			Logger(),
+	}
+
+	for _, dimension := range newCloudWatchDimensions(
+		cfg.InstanceType, cfg.InstanceId,
+		cfg.AutoScalingGroup, cfg.AggregatedOnly) {
+		reporter.dimensions = append(reporter.dimensions, emfDimension{
+			name:  aws.StringValue(dimension.Name),
+			value: aws.StringValue(dimension.Value),
+		})
+	}
+
+	switch cfg.Output {
+	case "", "stdout":
+		reporter.out = nopCloser{os.Stdout}
+	case "file":
+		if cfg.Path == "" {
+			err = errors.Errorf("A path must be provided for the file output")
+			return
+		}
+
+		reporter.out, err = os.OpenFile(cfg.Path,
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			err = errors.Wrapf(err, "Couldn't open %s.", cfg.Path)
+			return
+		}
+	case "tcp", "udp":
+		if cfg.Address == "" {
+			err = errors.Errorf("An address must be provided for the %s output", cfg.Output)
+			return
+		}
+	default:
+		err = errors.Errorf("Unknown EMF output %s", cfg.Output)
+		return
+	}
+
+	reporter.logger.Debug().
+		Interface("config", cfg).
+		Msg("reporter created")
+
+	return
+}
+
+// SendStat renders the stat as an EMF document and buffers it
+// until the next call to `Flush`.
+//
+// Stats holding non-finite values (NaN, ±Inf) are skipped as
+// they can't be represented in JSON.
+func (reporter *EMFReporter) SendStat(stat Stat) (err error) {
+	if !isFiniteStat(stat) {
+		reporter.logger.Warn().
+			Str("name", stat.Name).
+			Float64("value", stat.Value).
+			Msg("skipping stat with non-finite value")
+		return
+	}
+
+	document, err := reporter.document(stat)
+	if err != nil {
+		return
+	}
+
+	reporter.mu.Lock()
+	reporter.pending = append(reporter.pending, document)
+	reporter.mu.Unlock()
+
+	return
+}
+
+// Flush writes the buffered documents, one per line.
+//
+// For the tcp output, the connection is (re)established if
+// needed; for the udp output, each document is sent in its
+// own datagram.
+func (reporter *EMFReporter) Flush() (err error) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if len(reporter.pending) == 0 {
+		return
+	}
+
+	if reporter.out == nil {
+		reporter.out, err = net.Dial(reporter.cfg.Output, reporter.cfg.Address)
+		if err != nil {
+			reporter.out = nil
+			err = errors.Wrapf(err,
+				"Couldn't connect to %s.", reporter.cfg.Address)
+			return
+		}
+	}
+
+	if reporter.cfg.Output == "udp" {
+		for _, document := range reporter.pending {
+			_, err = reporter.out.Write(append(document, '\n'))
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		for _, document := range reporter.pending {
+			buf.Write(document)
+			buf.WriteByte('\n')
+		}
+
+		_, err = reporter.out.Write(buf.Bytes())
+	}
+
+	reporter.pending = nil
+
+	if err != nil {
+		if reporter.cfg.Output == "tcp" || reporter.cfg.Output == "udp" {
+			reporter.out.Close()
+			reporter.out = nil
+		}
+
+		err = errors.Wrapf(err, "Errored writing EMF documents.")
+		return
+	}
+
+	return
+}
+
+// Close flushes the remaining documents and closes the output.
+func (reporter *EMFReporter) Close() (err error) {
+	err = reporter.Flush()
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if reporter.out != nil {
+		closeErr := reporter.out.Close()
+		if err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr, "Errored closing EMF output.")
+		}
+	}
+
+	return
+}
+
+// document renders a stat as an EMF document carrying the
+// reporter dimensions as well as the stat-specific ones.
+func (reporter *EMFReporter) document(stat Stat) (document []byte, err error) {
+	var (
+		fields = map[string]interface{}{}
+		names  = make([]string, 0, len(reporter.dimensions)+len(stat.ExtraDimensions))
+	)
+
+	for _, dimension := range reporter.dimensions {
+		fields[dimension.name] = dimension.value
+		names = append(names, dimension.name)
+	}
+
+	for _, key := range sortedKeys(stat.ExtraDimensions) {
+		fields[key] = stat.ExtraDimensions[key]
+		names = append(names, key)
+	}
+
+	if stat.Statistics != nil {
+		fields[stat.Name] = emfStatisticSet{
+			Max:   stat.Statistics.Maximum,
+			Min:   stat.Statistics.Minimum,
+			Sum:   stat.Statistics.Sum,
+			Count: stat.Statistics.SampleCount,
+		}
+	} else {
+		fields[stat.Name] = stat.Value
+	}
+	fields["_aws"] = emfMetadata{
+		Timestamp: stat.When.UnixNano() / 1e6,
+		CloudWatchMetrics: []emfMetricDirective{
+			{
+				Namespace:  reporter.cfg.Namespace,
+				Dimensions: [][]string{names},
+				Metrics: []emfMetricInfo{
+					{
+						Name: stat.Name,
+						Unit: stat.Unit,
+					},
+				},
+			},
+		},
+	}
+
+	document, err = json.Marshal(fields)
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't encode EMF document.")
+		return
+	}
+
+	return
+}
+
+// isFiniteStat tells whether the value (or the statistics)
+// of a stat are all finite numbers.
+func isFiniteStat(stat Stat) bool {
+	var values = []float64{stat.Value}
+	if stat.Statistics != nil {
+		values = []float64{
+			stat.Statistics.Minimum,
+			stat.Statistics.Maximum,
+			stat.Statistics.Sum,
+			stat.Statistics.SampleCount,
+		}
+	}
+
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nopCloser wraps a writer that must not be closed (e.g.,
+// stdout).
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEMFReporterWritesDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-emf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "emf.log")
+
+	reporter, err := NewEMFReporter(EMFReporterConfig{
+		InstanceId:   "i-123",
+		InstanceType: "t2.micro",
+		Namespace:    "System/Linux",
+		Output:       "file",
+		Path:         path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var when = time.Unix(1500000000, 0)
+
+	for _, stat := range []Stat{
+		{
+			Name:  "DiskUtilization",
+			Unit:  "Percent",
+			Value: 42.5,
+			When:  when,
+			ExtraDimensions: map[string]string{
+				"Path": "/",
+			},
+		},
+		{
+			Name:  "NotANumber",
+			Unit:  "Percent",
+			Value: math.NaN(),
+			When:  when,
+		},
+		{
+			Name:  "MemoryUtilization",
+			Unit:  "Percent",
+			Value: 20,
+			When:  when,
+			Statistics: &StatisticSet{
+				Minimum:     10,
+				Maximum:     30,
+				Sum:         60,
+				SampleCount: 3,
+			},
+		},
+		{
+			Name:  "Infinite",
+			Unit:  "Count",
+			Value: 1,
+			When:  when,
+			Statistics: &StatisticSet{
+				Maximum:     math.Inf(1),
+				SampleCount: 1,
+			},
+		},
+	} {
+		if err := reporter.SendStat(stat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines = strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected non-finite stats to be skipped, got %d documents", len(lines))
+	}
+
+	for idx, expected := range []string{
+		`{
+			"InstanceId": "i-123",
+			"InstanceType": "t2.micro",
+			"Path": "/",
+			"DiskUtilization": 42.5,
+			"_aws": {
+				"Timestamp": 1500000000000,
+				"CloudWatchMetrics": [{
+					"Namespace": "System/Linux",
+					"Dimensions": [["InstanceType", "InstanceId", "Path"]],
+					"Metrics": [{"Name": "DiskUtilization", "Unit": "Percent"}]
+				}]
+			}
+		}`,
+		`{
+			"InstanceId": "i-123",
+			"InstanceType": "t2.micro",
+			"MemoryUtilization": {"Max": 30, "Min": 10, "Sum": 60, "Count": 3},
+			"_aws": {
+				"Timestamp": 1500000000000,
+				"CloudWatchMetrics": [{
+					"Namespace": "System/Linux",
+					"Dimensions": [["InstanceType", "InstanceId"]],
+					"Metrics": [{"Name": "MemoryUtilization", "Unit": "Percent"}]
+				}]
+			}
+		}`,
+	} {
+		var actual, wanted interface{}
+
+		if err := json.Unmarshal([]byte(lines[idx]), &actual); err != nil {
+			t.Fatalf("document %d isn't valid JSON: %s", idx, err)
+		}
+
+		if err := json.Unmarshal([]byte(expected), &wanted); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(actual, wanted) {
+			t.Errorf("document %d: expected\n%s\ngot\n%s", idx, expected, lines[idx])
+		}
+	}
+}
@@ -10,6 +10,18 @@ func NewReporter(reporterType string, cfg interface{}) (reporter Reporter, err e
 		reporter, err = NewCloudWatchReporter(cfg.(CloudWatchReporterConfig))
 	case "stdout":
 		reporter, err = NewStdoutReporter()
+	case "prometheus":
+		reporter, err = NewPrometheusReporter(cfg.(PrometheusReporterConfig))
+	case "statsd":
+		reporter, err = NewStatsdReporter(cfg.(StatsdReporterConfig))
+	case "influx":
+		reporter, err = NewInfluxReporter(cfg.(InfluxReporterConfig))
+	case "graphite":
+		reporter, err = NewGraphiteReporter(cfg.(GraphiteReporterConfig))
+	case "file":
+		reporter, err = NewFileReporter(cfg.(FileReporterConfig))
+	case "emf":
+		reporter, err = NewEMFReporter(cfg.(EMFReporterConfig))
 	default:
 		err = errors.Errorf("Unknown reporter type %s",
 			reporterType)
@@ -0,0 +1,397 @@
+package lib
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// fileRotationLayout is the layout of the timestamp appended
+// to the name of rotated files.
+const fileRotationLayout = "20060102T150405.000000000"
+
+var (
+	renameFile = os.Rename
+)
+
+// FileReporter implements the Reporter interface by writing
+// one JSON object per stat (newline-delimited) to a file,
+// rotating it based on its size and age.
+//
+// Rotated files get compressed and pruned in the background.
+type FileReporter struct {
+	logger     zerolog.Logger
+	cfg        FileReporterConfig
+	dimensions map[string]string
+
+	mu       sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	openedAt time.Time
+
+	tidyMu sync.Mutex
+	tidyWg sync.WaitGroup
+}
+
+// FileReporterConfig represents all the configuration
+// needed for initializing the file reporter.
+type FileReporterConfig struct {
+	InstanceDimensions
+
+	// Path is the file that stats are written to.
+	Path string `json:"path"`
+
+	// MaxSize is the size (in bytes) after which the file
+	// gets rotated. Zero disables size-based rotation.
+	MaxSize int64 `json:"max-size"`
+
+	// MaxAge is the time after which the file gets rotated.
+	// Zero disables time-based rotation.
+	MaxAge time.Duration `json:"max-age"`
+
+	// MaxBackups is the number of rotated files to keep.
+	// Zero keeps them all.
+	MaxBackups int `json:"max-backups"`
+
+	// Compress gzips rotated files.
+	Compress bool `json:"compress"`
+}
+
+// fileRecord is the schema of each line written.
+type fileRecord struct {
+	Name       string            `json:"name"`
+	Unit       string            `json:"unit"`
+	Value      float64           `json:"value"`
+	Timestamp  string            `json:"timestamp"`
+	Dimensions map[string]string `json:"dimensions"`
+}
+
+func NewFileReporter(cfg FileReporterConfig) (reporter *FileReporter, err error) {
+	if cfg.Path == "" {
+		err = errors.Errorf("A file path must be provided")
+		return
+	}
+
+	reporter = &FileReporter{
+		cfg:        cfg,
+		dimensions: cfg.InstanceDimensions.Map(),
+		logger: log.With().
+			Str("from", "reporter_file").
+			Str("path", cfg.Path).
+			Logger(),
+	}
+
+	err = reporter.open()
+	if err != nil {
+		return
+	}
+
+	reporter.logger.Debug().
+		Interface("config", cfg).
+		Msg("reporter created")
+
+	return
+}
+
+// SendStat writes the stat as a JSON line, rotating the file
+// beforehand if needed.
+//
+// A failed rotation doesn't prevent the stat from being
+// written: the current file keeps being used until rotating
+// it succeeds.
+func (reporter *FileReporter) SendStat(stat Stat) (err error) {
+	line, err := json.Marshal(fileRecord{
+		Name:       stat.Name,
+		Unit:       stat.Unit,
+		Value:      stat.Value,
+		Timestamp:  stat.When.UTC().Format(time.RFC3339Nano),
+		Dimensions: mergeDimensions(reporter.dimensions, stat.ExtraDimensions),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't encode stat.")
+		return
+	}
+	line = append(line, '\n')
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	var rotateErr error
+	if reporter.file != nil && reporter.shouldRotate(int64(len(line))) {
+		rotateErr = reporter.rotate()
+	}
+
+	if reporter.file == nil {
+		err = reporter.open()
+		if err != nil {
+			return
+		}
+	}
+
+	n, err := reporter.writer.Write(line)
+	reporter.size += int64(n)
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't write stat to %s.", reporter.cfg.Path)
+		return
+	}
+
+	err = rotateErr
+	return
+}
+
+// Flush makes sure that the lines written so far reach
+// the file.
+func (reporter *FileReporter) Flush() (err error) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if reporter.file == nil {
+		err = reporter.open()
+		if err != nil {
+			return
+		}
+	}
+
+	err = reporter.writer.Flush()
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't flush stats to %s.", reporter.cfg.Path)
+		return
+	}
+
+	return
+}
+
+// Close flushes the remaining lines and closes the file,
+// waiting for the rotated files to be compressed.
+func (reporter *FileReporter) Close() (err error) {
+	reporter.mu.Lock()
+	if reporter.file != nil {
+		err = reporter.close()
+	}
+	reporter.mu.Unlock()
+
+	reporter.tidyWg.Wait()
+	return
+}
+
+// open opens (or creates) the file for appending.
+func (reporter *FileReporter) open() (err error) {
+	err = os.MkdirAll(filepath.Dir(reporter.cfg.Path), 0755)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create directory of %s.", reporter.cfg.Path)
+		return
+	}
+
+	file, err := os.OpenFile(reporter.cfg.Path,
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't open %s.", reporter.cfg.Path)
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		err = errors.Wrapf(err, "Couldn't stat %s.", reporter.cfg.Path)
+		return
+	}
+
+	reporter.file = file
+	reporter.writer = bufio.NewWriter(file)
+	reporter.size = info.Size()
+	reporter.openedAt = time.Now()
+	return
+}
+
+// close flushes and closes the current file, leaving the
+// reporter without one (even if closing failed).
+func (reporter *FileReporter) close() (err error) {
+	err = reporter.writer.Flush()
+
+	closeErr := reporter.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	reporter.file = nil
+	reporter.writer = nil
+
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't close %s.", reporter.cfg.Path)
+		return
+	}
+
+	return
+}
+
+// shouldRotate indicates whether the file should be rotated
+// before writing `incoming` more bytes to it.
+func (reporter *FileReporter) shouldRotate(incoming int64) bool {
+	if reporter.size == 0 {
+		return false
+	}
+
+	if reporter.cfg.MaxSize > 0 && reporter.size+incoming > reporter.cfg.MaxSize {
+		return true
+	}
+
+	if reporter.cfg.MaxAge > 0 && time.Since(reporter.openedAt) >= reporter.cfg.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+// rotate moves the current file aside and opens a new one,
+// leaving the compression of the rotated file and the pruning
+// of old backups to the background.
+//
+// If the file can't be moved aside, it's reopened so that it
+// keeps being written to.
+func (reporter *FileReporter) rotate() (err error) {
+	err = reporter.close()
+	if err != nil {
+		return
+	}
+
+	var rotated = reporter.cfg.Path + "." + time.Now().UTC().Format(fileRotationLayout)
+
+	err = renameFile(reporter.cfg.Path, rotated)
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't rotate %s.", reporter.cfg.Path)
+
+		openErr := reporter.open()
+		if openErr != nil {
+			reporter.logger.Error().
+				Err(openErr).
+				Msg("failed to reopen file after failed rotation")
+		}
+		return
+	}
+
+	err = reporter.open()
+	if err != nil {
+		return
+	}
+
+	reporter.tidyWg.Add(1)
+	go reporter.tidy(rotated)
+
+	reporter.logger.Debug().
+		Str("rotated", rotated).
+		Msg("file rotated")
+
+	return
+}
+
+// tidy compresses a rotated file (if configured to) and prunes
+// the old backups.
+func (reporter *FileReporter) tidy(rotated string) {
+	defer reporter.tidyWg.Done()
+
+	reporter.tidyMu.Lock()
+	defer reporter.tidyMu.Unlock()
+
+	if reporter.cfg.Compress {
+		compressErr := gzipFile(rotated)
+		if compressErr != nil {
+			reporter.logger.Error().
+				Err(compressErr).
+				Str("rotated", rotated).
+				Msg("failed to compress rotated file")
+		}
+	}
+
+	pruneErr := reporter.prune()
+	if pruneErr != nil {
+		reporter.logger.Error().
+			Err(pruneErr).
+			Msg("failed to prune rotated files")
+	}
+}
+
+// prune removes the oldest rotated files beyond the maximum
+// number of backups.
+func (reporter *FileReporter) prune() (err error) {
+	if reporter.cfg.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(reporter.cfg.Path + ".*")
+	if err != nil {
+		return
+	}
+
+	var rotated = backups[:0]
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".tmp") {
+			rotated = append(rotated, backup)
+		}
+	}
+
+	// The timestamp layout sorts lexicographically.
+	sort.Strings(rotated)
+
+	for len(rotated) > reporter.cfg.MaxBackups {
+		err = os.Remove(rotated[0])
+		if err != nil {
+			return
+		}
+
+		rotated = rotated[1:]
+	}
+
+	return
+}
+
+// gzipFile compresses a file, replacing it by a `.gz` one.
+func gzipFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	var tmp = path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+
+	err = os.Rename(tmp, path+".gz")
+	if err != nil {
+		return
+	}
+
+	err = os.Remove(path)
+	return
+}
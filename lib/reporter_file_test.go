@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// countLines counts the lines of a file, decompressing it if
+// it's gzipped.
+func countLines(t *testing.T, path string) (lines int) {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var scanner = bufio.NewScanner(file)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner = bufio.NewScanner(gz)
+	}
+
+	for scanner.Scan() {
+		lines++
+	}
+
+	return
+}
+
+func TestFileReporterRotatesAndCompresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reporter, err := NewFileReporter(FileReporterConfig{
+		Path:       filepath.Join(dir, "stats.json"),
+		MaxSize:    200,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := reporter.SendStat(Stat{Name: "Metric", Value: float64(i), When: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := reporter.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "stats.json.*"))
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".gz") {
+			t.Errorf("expected %s to be compressed", backup)
+			continue
+		}
+
+		if lines := countLines(t, backup); lines == 0 {
+			t.Errorf("expected %s to hold stats", backup)
+		}
+	}
+
+	if lines := countLines(t, filepath.Join(dir, "stats.json")); lines == 0 {
+		t.Error("expected the current file to hold stats")
+	}
+}
+
+func TestFileReporterRecoversFromFailedRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reporter, err := NewFileReporter(FileReporterConfig{
+		Path:    filepath.Join(dir, "stats.json"),
+		MaxSize: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		renameFile = os.Rename
+	}()
+	renameFile = func(from, to string) error {
+		return errors.New("read-only filesystem")
+	}
+
+	for i := 0; i < 3; i++ {
+		err := reporter.SendStat(Stat{Name: "Metric", Value: float64(i), When: time.Now()})
+		if i > 0 && err == nil {
+			t.Fatal("expected the failed rotation to be reported")
+		}
+	}
+
+	if err := reporter.Flush(); err != nil {
+		t.Fatalf("expected flushing to work after a failed rotation, got %s", err)
+	}
+
+	renameFile = os.Rename
+	if err := reporter.SendStat(Stat{Name: "Metric", Value: 3, When: time.Now()}); err != nil {
+		t.Fatalf("expected the rotation to succeed, got %s", err)
+	}
+
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("expected closing twice to be harmless, got %s", err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "stats.json.*"))
+	if len(backups) != 1 || countLines(t, backups[0]) != 3 {
+		t.Fatalf("expected the stats written during the failed rotations to be kept, got %v", backups)
+	}
+
+	if lines := countLines(t, filepath.Join(dir, "stats.json")); lines != 1 {
+		t.Fatalf("expected a single stat after the rotation, got %d", lines)
+	}
+}
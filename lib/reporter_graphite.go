@@ -0,0 +1,267 @@
+package lib
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultGraphiteTemplate is the default template of
+	// the path of each metric.
+	defaultGraphiteTemplate = "{namespace}.{InstanceId}.{Name}.{Path}"
+
+	// defaultGraphiteBufferSize is the default number of
+	// lines kept in memory while the relay can't be reached.
+	defaultGraphiteBufferSize = 10000
+)
+
+var (
+	graphitePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+	graphiteUnsafe      = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+)
+
+// GraphiteReporter implements the Reporter interface by
+// sending stats to a carbon relay using the Graphite
+// plaintext protocol over TCP.
+//
+// While the relay can't be reached, lines are kept in a
+// bounded in-memory buffer (oldest dropped first) and
+// reconnections are attempted with an exponential backoff.
+type GraphiteReporter struct {
+	logger     zerolog.Logger
+	cfg        GraphiteReporterConfig
+	dimensions map[string]string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	backoff Backoff
+	pending []string
+	dropped int
+}
+
+// GraphiteReporterConfig represents all the configuration
+// needed for initializing the graphite reporter.
+type GraphiteReporterConfig struct {
+	InstanceDimensions
+
+	// Address is the `host:port` of the carbon relay.
+	Address string `json:"address"`
+
+	// Namespace fills the `{namespace}` placeholder.
+	Namespace string `json:"namespace"`
+
+	// Template is the path of each metric, where
+	// `{namespace}`, `{Name}`, `{StatUnit}` and any dimension
+	// (e.g., `{InstanceId}`, `{Path}`) get replaced by their
+	// sanitized values. The stat dimensions that the template
+	// doesn't reference are appended (sorted by name) so that
+	// series don't collide. Segments that end up empty are
+	// left out.
+	Template string `json:"template"`
+
+	// BufferSize is the maximum number of lines kept while
+	// the relay can't be reached.
+	BufferSize int `json:"buffer-size"`
+
+	// Timeout bounds connecting and writing to the relay.
+	Timeout time.Duration `json:"timeout"`
+
+	RetryInitialInterval time.Duration `json:"retry-initial-interval"`
+	RetryMaxInterval     time.Duration `json:"retry-max-interval"`
+}
+
+func NewGraphiteReporter(cfg GraphiteReporterConfig) (reporter *GraphiteReporter, err error) {
+	if cfg.Address == "" {
+		err = errors.Errorf("A graphite address must be provided")
+		return
+	}
+
+	if cfg.Template == "" {
+		cfg.Template = defaultGraphiteTemplate
+	}
+
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultGraphiteBufferSize
+	}
+
+	reporter = &GraphiteReporter{
+		cfg:        cfg,
+		dimensions: cfg.InstanceDimensions.Map(),
+		backoff: Backoff{
+			Initial: cfg.RetryInitialInterval,
+			Max:     cfg.RetryMaxInterval,
+		},
+		logger: log.With().
+			Str("from", "reporter_graphite").
+			Str("address", cfg.Address).
+			Logger(),
+	}
+
+	reporter.logger.Debug().
+		Interface("config", cfg).
+		Msg("reporter created")
+
+	return
+}
+
+// SendStat formats the stat as a plaintext line and buffers
+// it until the next call to `Flush`, dropping the oldest line
+// if the buffer is full.
+func (reporter *GraphiteReporter) SendStat(stat Stat) (err error) {
+	var line = reporter.path(stat) + " " +
+		strconv.FormatFloat(stat.Value, 'f', -1, 64) + " " +
+		strconv.FormatInt(stat.When.Unix(), 10) + "\n"
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if len(reporter.pending) >= reporter.cfg.BufferSize {
+		reporter.pending = reporter.pending[1:]
+		reporter.dropped++
+	}
+
+	reporter.pending = append(reporter.pending, line)
+	return
+}
+
+// Flush writes the buffered lines to the relay, connecting
+// to it first if needed.
+//
+// On failure, the lines are kept so that they get written by
+// a later flush (graphite overwrites points with the same
+// timestamp, so re-sending is harmless).
+func (reporter *GraphiteReporter) Flush() (err error) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if reporter.dropped > 0 {
+		reporter.logger.Warn().
+			Int("dropped", reporter.dropped).
+			Int("buffer-size", reporter.cfg.BufferSize).
+			Msg("buffer full, dropped oldest lines")
+		reporter.dropped = 0
+	}
+
+	if len(reporter.pending) == 0 {
+		return
+	}
+
+	var now = time.Now()
+	if reporter.conn == nil {
+		if !reporter.backoff.Ready(now) {
+			err = errors.Errorf(
+				"Graphite relay unreachable, %d lines buffered.",
+				len(reporter.pending))
+			return
+		}
+
+		reporter.conn, err = net.DialTimeout("tcp", reporter.cfg.Address, reporter.cfg.Timeout)
+		if err != nil {
+			reporter.conn = nil
+			reporter.retryLater(now)
+			err = errors.Wrapf(err,
+				"Couldn't connect to graphite at %s.", reporter.cfg.Address)
+			return
+		}
+
+		reporter.logger.Info().Msg("connected")
+	}
+
+	var buf bytes.Buffer
+	for _, line := range reporter.pending {
+		buf.WriteString(line)
+	}
+
+	if reporter.cfg.Timeout > 0 {
+		reporter.conn.SetWriteDeadline(now.Add(reporter.cfg.Timeout))
+	}
+
+	_, err = reporter.conn.Write(buf.Bytes())
+	if err != nil {
+		reporter.conn.Close()
+		reporter.conn = nil
+		reporter.retryLater(now)
+		err = errors.Wrapf(err,
+			"Errored sending metrics to graphite.")
+		return
+	}
+
+	reporter.backoff.Success()
+	reporter.pending = nil
+	return
+}
+
+// Close flushes the remaining lines and closes the
+// connection.
+func (reporter *GraphiteReporter) Close() (err error) {
+	err = reporter.Flush()
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if reporter.conn != nil {
+		reporter.conn.Close()
+		reporter.conn = nil
+	}
+
+	return
+}
+
+// retryLater delays the next connection attempt.
+func (reporter *GraphiteReporter) retryLater(now time.Time) {
+	delay := reporter.backoff.Failure(now)
+	reporter.logger.Warn().
+		Dur("retry-in", delay).
+		Int("buffered", len(reporter.pending)).
+		Msg("relay unreachable, backing off")
+}
+
+// path renders the template for a given stat, followed by
+// the values of the stat dimensions it doesn't reference.
+func (reporter *GraphiteReporter) path(stat Stat) string {
+	var values = mergeDimensions(reporter.dimensions, stat.ExtraDimensions)
+	values["namespace"] = reporter.cfg.Namespace
+	values["Name"] = stat.Name
+	values["StatUnit"] = stat.Unit
+
+	var (
+		referenced = map[string]bool{}
+		rendered   = graphitePlaceholder.ReplaceAllStringFunc(reporter.cfg.Template,
+			func(placeholder string) string {
+				var key = placeholder[1 : len(placeholder)-1]
+				referenced[key] = true
+				return graphiteSanitize(values[key])
+			})
+		segments = make([]string, 0)
+	)
+
+	for _, key := range sortedKeys(stat.ExtraDimensions) {
+		if !referenced[key] {
+			rendered += "." + graphiteSanitize(stat.ExtraDimensions[key])
+		}
+	}
+
+	for _, segment := range strings.Split(rendered, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return strings.Join(segments, ".")
+}
+
+// graphiteSanitize makes a value safe to be used as a segment
+// of a metric path, replacing dots, slashes, spaces and other
+// special characters by underscores.
+func graphiteSanitize(value string) string {
+	return graphiteUnsafe.ReplaceAllString(value, "_")
+}
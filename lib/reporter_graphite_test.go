@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestGraphiteReporterPath(t *testing.T) {
+	var stat = Stat{
+		Name: "SystemdUnitActive",
+		Unit: "Count",
+		ExtraDimensions: map[string]string{
+			"Unit": "nginx.service",
+			"Path": "/var/log",
+			"Core": "cpu0",
+		},
+	}
+
+	for _, tc := range []struct {
+		template string
+		expected string
+	}{
+		{
+			template: "",
+			expected: "awsmon.i-123.SystemdUnitActive._var_log.cpu0.nginx_service",
+		},
+		{
+			template: "{namespace}.{Unit}.{Name}.{StatUnit}",
+			expected: "awsmon.nginx_service.SystemdUnitActive.Count.cpu0._var_log",
+		},
+		{
+			template: "{Core}.{Missing}.{Name}",
+			expected: "cpu0.SystemdUnitActive._var_log.nginx_service",
+		},
+	} {
+		reporter, err := NewGraphiteReporter(GraphiteReporterConfig{
+			InstanceDimensions: InstanceDimensions{
+				InstanceId:   "i-123",
+				InstanceType: "t2.micro",
+			},
+			Address:   "127.0.0.1:2003",
+			Namespace: "awsmon",
+			Template:  tc.template,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path := reporter.path(stat); path != tc.expected {
+			t.Errorf("template '%s': expected %s, got %s", tc.template, tc.expected, path)
+		}
+	}
+}
+
+func TestGraphiteReporterPathsDontCollide(t *testing.T) {
+	reporter, err := NewGraphiteReporter(GraphiteReporterConfig{
+		Address:   "127.0.0.1:2003",
+		Namespace: "awsmon",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths = map[string]bool{}
+	for _, core := range []string{"", "cpu0", "cpu1"} {
+		var stat = Stat{Name: "CPUUtilization"}
+		if core != "" {
+			stat.ExtraDimensions = map[string]string{"Core": core}
+		}
+
+		var path = reporter.path(stat)
+		if paths[path] {
+			t.Fatalf("path %s rendered for more than one series", path)
+		}
+		paths[path] = true
+	}
+}
@@ -0,0 +1,317 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultInfluxBatchSize is the default maximum number
+	// of points written per HTTP request.
+	defaultInfluxBatchSize = 5000
+
+	// influxUDPMaxPayload is the maximum size of a packet
+	// sent over UDP.
+	influxUDPMaxPayload = 1432
+)
+
+// InfluxReporter implements the Reporter interface by writing
+// stats as InfluxDB line protocol points, either to an HTTP
+// write endpoint or over UDP.
+type InfluxReporter struct {
+	logger     zerolog.Logger
+	cfg        InfluxReporterConfig
+	client     *http.Client
+	conn       net.Conn
+	dimensions map[string]string
+
+	mu      sync.Mutex
+	pending []string
+}
+
+// InfluxReporterConfig represents all the configuration
+// needed for initializing the influx reporter.
+//
+// Exactly one of URL and UDPAddress must be set.
+type InfluxReporterConfig struct {
+	InstanceDimensions
+
+	// URL is the full write endpoint, including its query
+	// parameters (e.g., `http://localhost:8086/write?db=awsmon`
+	// or `http://localhost:8086/api/v2/write?org=o&bucket=b`).
+	URL string `json:"url"`
+
+	// Token is sent as `Authorization: Token <token>`.
+	Token string `json:"token"`
+
+	// Gzip compresses the body of the requests.
+	Gzip bool `json:"gzip"`
+
+	// Timeout bounds each HTTP request.
+	Timeout time.Duration `json:"timeout"`
+
+	// BatchSize is the maximum number of points per request.
+	BatchSize int `json:"batch-size"`
+
+	// UDPAddress is the `host:port` of an InfluxDB UDP
+	// listener.
+	UDPAddress string `json:"udp-address"`
+}
+
+func NewInfluxReporter(cfg InfluxReporterConfig) (reporter *InfluxReporter, err error) {
+	if (cfg.URL == "") == (cfg.UDPAddress == "") {
+		err = errors.Errorf("Exactly one of an influx URL or UDP address must be provided")
+		return
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultInfluxBatchSize
+	}
+
+	reporter = &InfluxReporter{
+		cfg:        cfg,
+		dimensions: cfg.InstanceDimensions.Map(),
+		logger:     log.With().Str("from", "reporter_influx").Logger(),
+	}
+
+	if cfg.UDPAddress != "" {
+		reporter.conn, err = net.Dial("udp", cfg.UDPAddress)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't connect to influx at %s.", cfg.UDPAddress)
+			return
+		}
+	} else {
+		reporter.client = &http.Client{
+			Timeout: cfg.Timeout,
+		}
+	}
+
+	reporter.logger.Debug().
+		Str("url", cfg.URL).
+		Str("udp-address", cfg.UDPAddress).
+		Msg("reporter created")
+
+	return
+}
+
+// SendStat formats the stat as a point and buffers it until
+// the next call to `Flush`.
+func (reporter *InfluxReporter) SendStat(stat Stat) (err error) {
+	var line = formatInfluxLine(stat, reporter.dimensions)
+
+	reporter.mu.Lock()
+	reporter.pending = append(reporter.pending, line)
+	reporter.mu.Unlock()
+
+	return
+}
+
+// Flush writes the buffered points in batches.
+func (reporter *InfluxReporter) Flush() (err error) {
+	reporter.mu.Lock()
+	var lines = reporter.pending
+	reporter.pending = nil
+	reporter.mu.Unlock()
+
+	if len(lines) == 0 {
+		return
+	}
+
+	if reporter.conn != nil {
+		err = reporter.writeUDP(lines)
+		return
+	}
+
+	var failed = 0
+	for start := 0; start < len(lines); start += reporter.cfg.BatchSize {
+		end := start + reporter.cfg.BatchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		batchErr := reporter.writeHTTP(lines[start:end])
+		if batchErr != nil {
+			failed++
+			reporter.logger.Error().
+				Err(batchErr).
+				Int("points", end-start).
+				Msg("failed to write batch")
+		}
+	}
+
+	if failed > 0 {
+		err = errors.Errorf("Errored writing %d batches of points to influx.", failed)
+		return
+	}
+
+	return
+}
+
+// Close flushes the remaining points.
+func (reporter *InfluxReporter) Close() (err error) {
+	err = reporter.Flush()
+
+	if reporter.conn != nil {
+		closeErr := reporter.conn.Close()
+		if err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr,
+				"Errored closing influx socket.")
+		}
+	}
+
+	return
+}
+
+// writeHTTP sends a batch of points to the write endpoint.
+func (reporter *InfluxReporter) writeHTTP(lines []string) (err error) {
+	var body bytes.Buffer
+
+	if reporter.cfg.Gzip {
+		gz := gzip.NewWriter(&body)
+		_, err = io.WriteString(gz, strings.Join(lines, "\n"))
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "Couldn't compress points.")
+			return
+		}
+	} else {
+		body.WriteString(strings.Join(lines, "\n"))
+	}
+
+	req, err := http.NewRequest("POST", reporter.cfg.URL, &body)
+	if err != nil {
+		err = errors.Wrapf(err, "Couldn't create influx write request.")
+		return
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if reporter.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if reporter.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+reporter.cfg.Token)
+	}
+
+	resp, err := reporter.client.Do(req)
+	if err != nil {
+		err = errors.Wrapf(err, "Errored writing points to influx.")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf("Influx write failed with status %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(msg)))
+		return
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	return
+}
+
+// writeUDP sends the points over UDP, packing as many of them
+// as fit in a single packet.
+func (reporter *InfluxReporter) writeUDP(lines []string) (err error) {
+	var packet bytes.Buffer
+
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		defer packet.Reset()
+
+		_, writeErr := reporter.conn.Write(packet.Bytes())
+		return writeErr
+	}
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > influxUDPMaxPayload {
+			err = send()
+			if err != nil {
+				break
+			}
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if err == nil {
+		err = send()
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "Errored sending points to influx.")
+		return
+	}
+
+	return
+}
+
+// formatInfluxLine renders a stat as a line protocol point
+// whose measurement is the stat name, with the dimensions as
+// tags and the value in the `value` field.
+func formatInfluxLine(stat Stat, base map[string]string) string {
+	var (
+		line       strings.Builder
+		dimensions = mergeDimensions(base, stat.ExtraDimensions)
+	)
+
+	line.WriteString(influxEscape(stat.Name, ", "))
+	for _, key := range sortedKeys(dimensions) {
+		if dimensions[key] == "" {
+			continue
+		}
+
+		line.WriteByte(',')
+		line.WriteString(influxEscape(key, ",= "))
+		line.WriteByte('=')
+		line.WriteString(influxEscape(dimensions[key], ",= "))
+	}
+
+	line.WriteString(" value=")
+	line.WriteString(strconv.FormatFloat(stat.Value, 'f', -1, 64))
+	line.WriteByte(' ')
+	line.WriteString(strconv.FormatInt(stat.When.UnixNano(), 10))
+
+	return line.String()
+}
+
+// influxEscape escapes the characters that have a meaning in
+// a given part of a line protocol point, as well as the escape
+// character itself.
+func influxEscape(value, special string) string {
+	var escaped strings.Builder
+
+	for _, r := range value {
+		if r == '\n' {
+			escaped.WriteString(`\n`)
+			continue
+		}
+
+		if r == '\\' || strings.ContainsRune(special, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+
+	return escaped.String()
+}
@@ -0,0 +1,222 @@
+package lib
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// influxStub is a local InfluxDB write endpoint that records
+// the requests it receives, failing those that come after
+// `failAfter` requests (if positive).
+type influxStub struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	requests  []influxRequest
+	failAfter int
+}
+
+type influxRequest struct {
+	header http.Header
+	body   string
+}
+
+func newInfluxStub(t *testing.T) (stub *influxStub) {
+	stub = &influxStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("invalid gzip body: %s", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reader = gz
+		}
+
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Errorf("couldn't read body: %s", err)
+		}
+
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+
+		stub.requests = append(stub.requests, influxRequest{
+			header: r.Header,
+			body:   string(body),
+		})
+
+		if stub.failAfter > 0 && len(stub.requests) > stub.failAfter {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"partial write"}`)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return
+}
+
+// recorded retrieves the requests received so far.
+func (stub *influxStub) recorded() []influxRequest {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	return append([]influxRequest(nil), stub.requests...)
+}
+
+func (stub *influxStub) setFailAfter(requests int) {
+	stub.mu.Lock()
+	stub.failAfter = requests
+	stub.mu.Unlock()
+}
+
+var influxTestTime = time.Unix(1500000000, 123)
+
+func TestInfluxReporterWritesLineProtocol(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		var stub = newInfluxStub(t)
+		defer stub.Close()
+
+		reporter, err := NewInfluxReporter(InfluxReporterConfig{
+			URL:     stub.URL + "/write?db=awsmon",
+			Timeout: 5 * time.Second,
+			InstanceDimensions: InstanceDimensions{
+				InstanceId: "i-123",
+			},
+			Token: "secret",
+			Gzip:  compressed,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reporter.SendStat(Stat{
+			Name:  "DiskUtilization",
+			Value: 42.5,
+			When:  influxTestTime,
+			ExtraDimensions: map[string]string{
+				"Path":  `/mnt/my disk,a=b\c`,
+				"Empty": "",
+			},
+		})
+		reporter.SendStat(Stat{
+			Name:  "Load Avg,1",
+			Value: 1,
+			When:  influxTestTime,
+		})
+
+		if err := reporter.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		var requests = stub.recorded()
+		if len(requests) != 1 {
+			t.Fatalf("expected a single request, got %d", len(requests))
+		}
+
+		var (
+			req      = requests[0]
+			expected = `DiskUtilization,InstanceId=i-123,Path=/mnt/my\ disk\,a\=b\\c value=42.5 1500000000000000123` + "\n" +
+				`Load\ Avg\,1,InstanceId=i-123 value=1 1500000000000000123`
+		)
+
+		if req.body != expected {
+			t.Errorf("gzip=%t: expected body\n%s\ngot\n%s", compressed, expected, req.body)
+		}
+
+		if auth := req.header.Get("Authorization"); auth != "Token secret" {
+			t.Errorf("gzip=%t: unexpected authorization header '%s'", compressed, auth)
+		}
+
+		var encoding = req.header.Get("Content-Encoding")
+		if compressed != (encoding == "gzip") {
+			t.Errorf("gzip=%t: unexpected content encoding '%s'", compressed, encoding)
+		}
+	}
+}
+
+func TestInfluxReporterBatchesPoints(t *testing.T) {
+	var stub = newInfluxStub(t)
+	defer stub.Close()
+
+	reporter, err := NewInfluxReporter(InfluxReporterConfig{
+		URL:       stub.URL + "/write?db=awsmon",
+		Timeout:   5 * time.Second,
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		reporter.SendStat(Stat{Name: "Metric", Value: float64(i), When: influxTestTime})
+	}
+
+	if err := reporter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = stub.recorded()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+
+	for idx, points := range []int{2, 2, 1} {
+		if lines := strings.Split(requests[idx].body, "\n"); len(lines) != points {
+			t.Errorf("expected %d points in batch %d, got %d", points, idx, len(lines))
+		}
+	}
+
+	if auth := requests[0].header.Get("Authorization"); auth != "" {
+		t.Errorf("expected no authorization header without a token, got '%s'", auth)
+	}
+}
+
+func TestInfluxReporterReportsFailedBatches(t *testing.T) {
+	var stub = newInfluxStub(t)
+	defer stub.Close()
+
+	stub.setFailAfter(1)
+
+	reporter, err := NewInfluxReporter(InfluxReporterConfig{
+		URL:       stub.URL + "/write?db=awsmon",
+		Timeout:   5 * time.Second,
+		BatchSize: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		reporter.SendStat(Stat{Name: "Metric", Value: float64(i), When: influxTestTime})
+	}
+
+	err = reporter.Flush()
+	if err == nil {
+		t.Fatal("expected the failed batches to be reported")
+	}
+
+	if !strings.Contains(err.Error(), "2 batches") {
+		t.Errorf("expected 2 failed batches, got '%s'", err)
+	}
+
+	if requests := stub.recorded(); len(requests) != 3 {
+		t.Errorf("expected every batch to be attempted, got %d requests", len(requests))
+	}
+
+	stub.setFailAfter(0)
+	if err := reporter.Flush(); err != nil {
+		t.Errorf("expected nothing left to flush, got %s", err)
+	}
+}
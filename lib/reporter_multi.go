@@ -0,0 +1,276 @@
+package lib
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultSinkQueueSize is the number of operations that
+	// can be queued for a sink before stats start being
+	// dropped.
+	defaultSinkQueueSize = 1024
+
+	// sinkCloseTimeout is how long the sinks are given to
+	// flush their remaining stats when closing.
+	sinkCloseTimeout = 10 * time.Second
+)
+
+// MultiReporterSink names a reporter that the MultiReporter
+// fans out to.
+type MultiReporterSink struct {
+	Name     string
+	Reporter Reporter
+}
+
+// MultiReporter implements the Reporter interface by
+// sending every stat to several reporters (sinks).
+//
+// Each sink is driven by its own goroutine through a bounded
+// queue so that a slow or failing sink doesn't block the
+// others: when a sink's queue is full, its stats get dropped.
+type MultiReporter struct {
+	logger       zerolog.Logger
+	sinks        []*reporterSink
+	closeTimeout time.Duration
+}
+
+// reporterSink wraps a reporter with its queue of pending
+// operations and its own error accounting.
+type reporterSink struct {
+	name     string
+	reporter Reporter
+	logger   zerolog.Logger
+	ops      chan reporterOp
+	done     chan struct{}
+
+	mu          sync.Mutex
+	lastErr     error
+	errors      int
+	consecutive int
+	dropped     int
+}
+
+// reporterOpKind identifies what a sink should do with
+// an operation.
+type reporterOpKind int
+
+const (
+	reporterOpStat reporterOpKind = iota
+	reporterOpFlush
+	reporterOpClose
+)
+
+type reporterOp struct {
+	kind reporterOpKind
+	stat Stat
+}
+
+// NewMultiReporter creates a reporter that fans out to all the
+// sinks provided. A queueSize of zero picks a default.
+func NewMultiReporter(sinks []MultiReporterSink, queueSize int) (reporter *MultiReporter, err error) {
+	if len(sinks) == 0 {
+		err = errors.Errorf("at least one reporter must be provided")
+		return
+	}
+
+	if queueSize <= 0 {
+		queueSize = defaultSinkQueueSize
+	}
+
+	reporter = &MultiReporter{
+		logger:       log.With().Str("from", "reporter_multi").Logger(),
+		closeTimeout: sinkCloseTimeout,
+	}
+
+	for _, sink := range sinks {
+		s := &reporterSink{
+			name:     sink.Name,
+			reporter: sink.Reporter,
+			ops:      make(chan reporterOp, queueSize),
+			done:     make(chan struct{}),
+			logger: log.With().
+				Str("from", "reporter_multi").
+				Str("sink", sink.Name).
+				Logger(),
+		}
+
+		go s.run()
+		reporter.sinks = append(reporter.sinks, s)
+	}
+
+	return
+}
+
+// SendStat queues the stat for every sink without blocking.
+func (reporter *MultiReporter) SendStat(stat Stat) (err error) {
+	for _, sink := range reporter.sinks {
+		sink.enqueue(reporterOp{
+			kind: reporterOpStat,
+			stat: stat,
+		})
+	}
+
+	return
+}
+
+// Flush asks every sink to flush its stats without waiting for
+// them to do so.
+//
+// The error returned (if any) lists the sinks whose operations
+// failed since the previous flush, so that failing sinks
+// surface even though sinks are flushed asynchronously.
+func (reporter *MultiReporter) Flush() (err error) {
+	var failing []string
+
+	for _, sink := range reporter.sinks {
+		sink.enqueue(reporterOp{
+			kind: reporterOpFlush,
+		})
+
+		sink.mu.Lock()
+		if sink.lastErr != nil {
+			failing = append(failing, sink.name+": "+sink.lastErr.Error())
+			sink.lastErr = nil
+		}
+		sink.mu.Unlock()
+	}
+
+	if len(failing) > 0 {
+		err = errors.Errorf("%d out of %d reporters failing: %s",
+			len(failing), len(reporter.sinks), strings.Join(failing, "; "))
+		return
+	}
+
+	return
+}
+
+// Close closes all the sinks concurrently, giving them a
+// single deadline to deliver what's still queued.
+func (reporter *MultiReporter) Close() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reporter.closeTimeout)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failing []string
+	)
+
+	for _, sink := range reporter.sinks {
+		wg.Add(1)
+		go func(sink *reporterSink) {
+			defer wg.Done()
+
+			closeErr := sink.close(ctx)
+			if closeErr != nil {
+				mu.Lock()
+				failing = append(failing, sink.name+": "+closeErr.Error())
+				mu.Unlock()
+			}
+		}(sink)
+	}
+
+	wg.Wait()
+
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		err = errors.Errorf("failed to close reporters: %s",
+			strings.Join(failing, "; "))
+		return
+	}
+
+	return
+}
+
+// close closes the sink once it has gone through what's
+// still queued, unless the context is done first.
+func (s *reporterSink) close(ctx context.Context) (err error) {
+	select {
+	case s.ops <- reporterOp{kind: reporterOpClose}:
+	case <-ctx.Done():
+		err = errors.Errorf("timed out queueing close")
+		return
+	}
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		err = errors.Errorf("timed out closing")
+		return
+	}
+
+	s.mu.Lock()
+	err = s.lastErr
+	s.mu.Unlock()
+	return
+}
+
+// enqueue queues an operation, dropping it if the sink's
+// queue is full.
+func (s *reporterSink) enqueue(op reporterOp) {
+	select {
+	case s.ops <- op:
+	default:
+		s.mu.Lock()
+		s.dropped++
+		var dropped = s.dropped
+		s.mu.Unlock()
+
+		s.logger.Warn().
+			Int("dropped", dropped).
+			Msg("sink queue full, dropping")
+	}
+}
+
+// run processes the sink's operations until it gets closed.
+func (s *reporterSink) run() {
+	defer close(s.done)
+
+	for op := range s.ops {
+		var err error
+
+		switch op.kind {
+		case reporterOpStat:
+			err = s.reporter.SendStat(op.stat)
+		case reporterOpFlush:
+			err = s.reporter.Flush()
+		case reporterOpClose:
+			s.record(s.reporter.Close())
+			return
+		}
+
+		if op.kind == reporterOpFlush || err != nil {
+			s.record(err)
+		}
+	}
+}
+
+// record accounts for the result of an operation.
+func (s *reporterSink) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastErr = err
+	if err == nil {
+		s.consecutive = 0
+		return
+	}
+
+	s.errors++
+	s.consecutive++
+
+	s.logger.Error().
+		Err(err).
+		Int("consecutive", s.consecutive).
+		Int("total", s.errors).
+		Int("dropped", s.dropped).
+		Msg("sink failed")
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeReporter is a reporter whose operations fail with
+// `err` and whose Close blocks until `unblock` is closed.
+type fakeReporter struct {
+	mu      sync.Mutex
+	err     error
+	stats   []Stat
+	unblock chan struct{}
+}
+
+func (r *fakeReporter) SendStat(stat Stat) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats = append(r.stats, stat)
+	return
+}
+
+func (r *fakeReporter) Flush() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.err
+	return
+}
+
+func (r *fakeReporter) Close() (err error) {
+	if r.unblock != nil {
+		<-r.unblock
+	}
+
+	err = r.Flush()
+	return
+}
+
+func (r *fakeReporter) setErr(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+}
+
+// waitForError waits for a sink to record a failure.
+func waitForError(t *testing.T, sink *reporterSink) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		sink.mu.Lock()
+		var failed = sink.lastErr != nil
+		sink.mu.Unlock()
+
+		if failed {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("sink %s didn't fail", sink.name)
+}
+
+func TestMultiReporterFlushReportsErrorsOnce(t *testing.T) {
+	var failing = &fakeReporter{err: errors.New("unreachable")}
+
+	reporter, err := NewMultiReporter([]MultiReporterSink{
+		{Name: "ok", Reporter: &fakeReporter{}},
+		{Name: "failing", Reporter: failing},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reporter.Close()
+
+	reporter.Flush()
+	waitForError(t, reporter.sinks[1])
+
+	failing.setErr(nil)
+	if err := reporter.Flush(); err == nil {
+		t.Fatal("expected the failed flush to be reported")
+	}
+
+	if err := reporter.Flush(); err != nil {
+		t.Fatalf("expected the failure not to be reported again, got %s", err)
+	}
+}
+
+func TestMultiReporterClosesSinksConcurrently(t *testing.T) {
+	var (
+		unblock = make(chan struct{})
+		sinks   []MultiReporterSink
+	)
+	defer close(unblock)
+
+	for _, name := range []string{"a", "b", "c"} {
+		sinks = append(sinks, MultiReporterSink{
+			Name:     name,
+			Reporter: &fakeReporter{unblock: unblock},
+		})
+	}
+
+	reporter, err := NewMultiReporter(sinks, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reporter.closeTimeout = 500 * time.Millisecond
+
+	var start = time.Now()
+	if err := reporter.Close(); err == nil {
+		t.Fatal("expected wedged sinks to time out")
+	}
+
+	if elapsed := time.Since(start); elapsed > 3*reporter.closeTimeout {
+		t.Fatalf("expected sinks to share a single deadline, took %s", elapsed)
+	}
+}
@@ -0,0 +1,318 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// PrometheusReporter implements the Reporter interface by
+// keeping the latest value of each stat and exposing them
+// over HTTP in the Prometheus text exposition format.
+type PrometheusReporter struct {
+	logger   zerolog.Logger
+	cfg      PrometheusReporterConfig
+	server   *http.Server
+	listener net.Listener
+
+	mu     sync.Mutex
+	series map[string]*prometheusSeries
+}
+
+// PrometheusReporterConfig represents all the configuration
+// needed for initializing the prometheus reporter.
+type PrometheusReporterConfig struct {
+	// Address is the address to listen on (e.g., `:9273`).
+	Address string `json:"address"`
+
+	// Path is where the metrics are served (defaults to
+	// `/metrics`).
+	Path string `json:"path"`
+
+	// Prefix is prepended to the name of every metric.
+	Prefix string `json:"prefix"`
+
+	// StaleAfter is how long a series is kept without
+	// receiving a new value before it stops being exposed.
+	StaleAfter time.Duration `json:"stale-after"`
+
+	// Labels are added to every series.
+	Labels map[string]string `json:"labels"`
+}
+
+// prometheusSeries holds the latest value of a series,
+// identified by its name and labels.
+type prometheusSeries struct {
+	name    string
+	unit    string
+	labels  string
+	value   float64
+	updated time.Time
+}
+
+func NewPrometheusReporter(cfg PrometheusReporterConfig) (reporter *PrometheusReporter, err error) {
+	if cfg.Address == "" {
+		err = errors.Errorf("A listen address must be provided")
+		return
+	}
+
+	if cfg.Path == "" {
+		cfg.Path = "/metrics"
+	}
+
+	if cfg.StaleAfter <= 0 {
+		err = errors.Errorf("StaleAfter must be positive")
+		return
+	}
+
+	reporter = &PrometheusReporter{
+		cfg:    cfg,
+		series: map[string]*prometheusSeries{},
+		logger: log.With().
+			Str("from", "reporter_prometheus").
+			Str("address", cfg.Address).
+			Logger(),
+	}
+
+	reporter.listener, err = net.Listen("tcp", cfg.Address)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't listen on %s.", cfg.Address)
+		return
+	}
+
+	var mux = http.NewServeMux()
+	mux.HandleFunc(cfg.Path, reporter.handleMetrics)
+	reporter.server = &http.Server{
+		Handler: mux,
+	}
+
+	go func() {
+		serveErr := reporter.server.Serve(reporter.listener)
+		if serveErr != nil && serveErr != http.ErrServerClosed {
+			reporter.logger.Error().
+				Err(serveErr).
+				Msg("metrics server stopped")
+		}
+	}()
+
+	reporter.logger.Debug().
+		Str("path", cfg.Path).
+		Msg("reporter created")
+
+	return
+}
+
+// SendStat records the stat as the latest value of its series.
+func (reporter *PrometheusReporter) SendStat(stat Stat) (err error) {
+	var (
+		name   = prometheusMetricName(reporter.cfg.Prefix, stat.Name)
+		labels = prometheusLabels(reporter.cfg.Labels, stat.ExtraDimensions)
+		key    = name + labels
+	)
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	reporter.series[key] = &prometheusSeries{
+		name:    name,
+		unit:    stat.Unit,
+		labels:  labels,
+		value:   stat.Value,
+		updated: time.Now(),
+	}
+
+	return
+}
+
+// Flush is a no-op given that the latest values are
+// served whenever they get scraped.
+func (reporter *PrometheusReporter) Flush() (err error) {
+	return
+}
+
+// Close stops serving the metrics.
+func (reporter *PrometheusReporter) Close() (err error) {
+	err = reporter.server.Close()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored closing metrics server.")
+		return
+	}
+
+	return
+}
+
+// handleMetrics writes all the series that are not stale in
+// the text exposition format.
+func (reporter *PrometheusReporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(reporter.expose(time.Now()))
+}
+
+// expose renders the series that have been updated within
+// the staleness period, expiring the others.
+func (reporter *PrometheusReporter) expose(now time.Time) []byte {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	var series = make([]*prometheusSeries, 0, len(reporter.series))
+	for key, s := range reporter.series {
+		if now.Sub(s.updated) > reporter.cfg.StaleAfter {
+			delete(reporter.series, key)
+			continue
+		}
+
+		series = append(series, s)
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return series[i].labels < series[j].labels
+	})
+
+	var (
+		buf  bytes.Buffer
+		last string
+	)
+
+	for _, s := range series {
+		if s.name != last {
+			fmt.Fprintf(&buf, "# HELP %s awsmon stat (unit: %s)\n", s.name, s.unit)
+			fmt.Fprintf(&buf, "# TYPE %s gauge\n", s.name)
+			last = s.name
+		}
+
+		fmt.Fprintf(&buf, "%s%s %s\n", s.name, s.labels,
+			strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+
+	return buf.Bytes()
+}
+
+// prometheusMetricName converts a stat name (e.g.,
+// `MemoryUtilization`) into a prometheus metric name (e.g.,
+// `awsmon_memory_utilization`).
+func prometheusMetricName(prefix, name string) string {
+	name = prometheusSnakeCase(name)
+	if prefix != "" {
+		name = prometheusSanitize(prefix) + "_" + name
+	}
+
+	return prometheusIdentifier(name)
+}
+
+// prometheusLabels renders the label set of a series, sorted
+// by label name. Stat dimensions take precedence over the
+// reporter labels.
+func prometheusLabels(base, extra map[string]string) string {
+	var labels = map[string]string{}
+	for k, v := range base {
+		labels[prometheusLabelName(k)] = v
+	}
+	for k, v := range extra {
+		labels[prometheusLabelName(k)] = v
+	}
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var names = make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs = make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+`="`+prometheusEscape(labels[name])+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// prometheusSnakeCase converts a CamelCase identifier into a
+// valid snake_case prometheus identifier, keeping acronyms
+// together (e.g., `InstanceId` becomes `instance_id` and
+// `CPUIdle` becomes `cpu_idle`).
+func prometheusSnakeCase(name string) string {
+	var (
+		runes = []rune(name)
+		out   []rune
+	)
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			var (
+				prev     = runes[i-1]
+				nextLow  = i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				prevLow  = unicode.IsLower(prev) || unicode.IsDigit(prev)
+				prevUp   = unicode.IsUpper(prev)
+				boundary = prevLow || (prevUp && nextLow)
+			)
+
+			if boundary {
+				out = append(out, '_')
+			}
+		}
+
+		out = append(out, unicode.ToLower(r))
+	}
+
+	return prometheusSanitize(string(out))
+}
+
+// prometheusLabelName converts a dimension name into a
+// prometheus label name, which (unlike metric names) can't
+// contain colons.
+func prometheusLabelName(name string) string {
+	return prometheusIdentifier(
+		strings.Replace(prometheusSnakeCase(name), ":", "_", -1))
+}
+
+// prometheusIdentifier prefixes identifiers that start with a
+// digit with an underscore given that prometheus doesn't allow
+// them to.
+func prometheusIdentifier(name string) string {
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		return "_" + name
+	}
+
+	return name
+}
+
+// prometheusSanitize replaces the characters that are not
+// allowed in prometheus identifiers by underscores.
+func prometheusSanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// prometheusEscape escapes a label value.
+func prometheusEscape(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+	).Replace(value)
+}
@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetricName(t *testing.T) {
+	for _, tc := range []struct {
+		prefix   string
+		name     string
+		expected string
+	}{
+		{"awsmon", "MemoryUtilization", "awsmon_memory_utilization"},
+		{"awsmon", "CPUIdle", "awsmon_cpu_idle"},
+		{"", "LoadAvg1", "load_avg1"},
+		{"", "5xxErrors", "_5xx_errors"},
+		{"9-to-5", "Requests", "_9_to_5_requests"},
+		{"my.app", "Disk Utilization", "my_app_disk_utilization"},
+	} {
+		if name := prometheusMetricName(tc.prefix, tc.name); name != tc.expected {
+			t.Errorf("%s/%s: expected %s, got %s", tc.prefix, tc.name, tc.expected, name)
+		}
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	var labels = prometheusLabels(
+		map[string]string{
+			"InstanceId": "i-123",
+			"Path":       "/",
+		},
+		map[string]string{
+			"Path":     `C:\"data"`,
+			"0Core":    "cpu0",
+			"ns:label": "value",
+		})
+
+	var expected = `{_0_core="cpu0",instance_id="i-123",ns_label="value",path="C:\\\"data\""}`
+	if labels != expected {
+		t.Fatalf("expected %s, got %s", expected, labels)
+	}
+}
+
+func scrape(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type '%s'", contentType)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestPrometheusReporterScrape(t *testing.T) {
+	var reporter = &PrometheusReporter{
+		cfg: PrometheusReporterConfig{
+			Prefix:     "awsmon",
+			StaleAfter: time.Minute,
+			Labels:     map[string]string{"InstanceId": "i-123"},
+		},
+		series: map[string]*prometheusSeries{},
+	}
+
+	var server = httptest.NewServer(http.HandlerFunc(reporter.handleMetrics))
+	defer server.Close()
+
+	for _, stat := range []Stat{
+		{Name: "MemoryUtilization", Unit: "Percent", Value: 40},
+		{Name: "DiskUtilization", Unit: "Percent", Value: 10, ExtraDimensions: map[string]string{"Path": "/data"}},
+		{Name: "DiskUtilization", Unit: "Percent", Value: 20, ExtraDimensions: map[string]string{"Path": "/"}},
+		{Name: "MemoryUtilization", Unit: "Percent", Value: 50.5},
+	} {
+		if err := reporter.SendStat(stat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var expected = `# HELP awsmon_disk_utilization awsmon stat (unit: Percent)
+# TYPE awsmon_disk_utilization gauge
+awsmon_disk_utilization{instance_id="i-123",path="/"} 20
+awsmon_disk_utilization{instance_id="i-123",path="/data"} 10
+# HELP awsmon_memory_utilization awsmon stat (unit: Percent)
+# TYPE awsmon_memory_utilization gauge
+awsmon_memory_utilization{instance_id="i-123"} 50.5
+`
+
+	if body := scrape(t, server.URL); body != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, body)
+	}
+
+	// the disk mounted at /data stops being sampled.
+	reporter.mu.Lock()
+	for _, s := range reporter.series {
+		s.updated = s.updated.Add(-2 * time.Minute)
+	}
+	reporter.mu.Unlock()
+
+	for _, stat := range []Stat{
+		{Name: "MemoryUtilization", Unit: "Percent", Value: 60},
+		{Name: "DiskUtilization", Unit: "Percent", Value: 30, ExtraDimensions: map[string]string{"Path": "/"}},
+	} {
+		reporter.SendStat(stat)
+	}
+
+	expected = `# HELP awsmon_disk_utilization awsmon stat (unit: Percent)
+# TYPE awsmon_disk_utilization gauge
+awsmon_disk_utilization{instance_id="i-123",path="/"} 30
+# HELP awsmon_memory_utilization awsmon stat (unit: Percent)
+# TYPE awsmon_memory_utilization gauge
+awsmon_memory_utilization{instance_id="i-123"} 60
+`
+
+	if body := scrape(t, server.URL); body != expected {
+		t.Fatalf("expected the stale series to expire, got\n%s", body)
+	}
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if len(reporter.series) != 2 {
+		t.Fatalf("expected the stale series to be dropped, got %d series", len(reporter.series))
+	}
+}
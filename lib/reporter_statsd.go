@@ -0,0 +1,251 @@
+package lib
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultStatsdMTU is the default maximum size of a packet,
+// suited for ethernet networks once IP and UDP headers are
+// taken into account.
+const defaultStatsdMTU = 1432
+
+// StatsdReporter implements the Reporter interface by sending
+// every stat as a StatsD gauge over a datagram socket
+// (UDP or unix), coalescing several gauges per packet.
+type StatsdReporter struct {
+	logger     zerolog.Logger
+	cfg        StatsdReporterConfig
+	conn       net.Conn
+	dimensions map[string]string
+
+	mu     sync.Mutex
+	packet bytes.Buffer
+}
+
+// StatsdReporterConfig represents all the configuration
+// needed for initializing the statsd reporter.
+type StatsdReporterConfig struct {
+	InstanceDimensions
+
+	// Network is either `udp` (default) or `unixgram`.
+	Network string `json:"network"`
+
+	// Address is the `host:port` of the agent or the path
+	// to its unix socket.
+	Address string `json:"address"`
+
+	// Prefix is prepended to the name of every gauge. It may
+	// be made of several dot-separated segments.
+	Prefix string `json:"prefix"`
+
+	// Tags enables DogStatsD-style tags built from the
+	// dimensions (the default). Without tags, the values of
+	// the stat dimensions are appended to the gauge name
+	// instead.
+	Tags bool `json:"tags"`
+
+	// MTU is the maximum size of a packet.
+	MTU int `json:"mtu"`
+}
+
+func NewStatsdReporter(cfg StatsdReporterConfig) (reporter *StatsdReporter, err error) {
+	if cfg.Address == "" {
+		err = errors.Errorf("A statsd address must be provided")
+		return
+	}
+
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+
+	if cfg.Network != "udp" && cfg.Network != "unixgram" {
+		err = errors.Errorf("Unsupported statsd network %s", cfg.Network)
+		return
+	}
+
+	if cfg.MTU <= 0 {
+		cfg.MTU = defaultStatsdMTU
+	}
+
+	cfg.Prefix = statsdSanitizePrefix(cfg.Prefix)
+
+	reporter = &StatsdReporter{
+		cfg:        cfg,
+		dimensions: cfg.InstanceDimensions.Map(),
+		logger: log.With().
+			Str("from", "reporter_statsd").
+			Str("address", cfg.Address).
+			Logger(),
+	}
+
+	reporter.conn, err = net.Dial(cfg.Network, cfg.Address)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't connect to statsd at %s.", cfg.Address)
+		return
+	}
+
+	reporter.logger.Debug().
+		Interface("config", cfg).
+		Msg("reporter created")
+
+	return
+}
+
+// SendStat formats the stat as a gauge and appends it to the
+// current packet, sending the packet beforehand if the gauge
+// wouldn't fit.
+func (reporter *StatsdReporter) SendStat(stat Stat) (err error) {
+	var line = reporter.format(stat)
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if reporter.packet.Len() > 0 &&
+		reporter.packet.Len()+1+len(line) > reporter.cfg.MTU {
+		err = reporter.sendPacket()
+		if err != nil {
+			return
+		}
+	}
+
+	if reporter.packet.Len() > 0 {
+		reporter.packet.WriteByte('\n')
+	}
+	reporter.packet.WriteString(line)
+
+	return
+}
+
+// Flush sends the gauges that are still waiting in the
+// current packet.
+func (reporter *StatsdReporter) Flush() (err error) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	err = reporter.sendPacket()
+	return
+}
+
+// Close flushes the remaining gauges and closes the socket.
+func (reporter *StatsdReporter) Close() (err error) {
+	err = reporter.Flush()
+
+	closeErr := reporter.conn.Close()
+	if err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr,
+			"Errored closing statsd socket.")
+	}
+
+	return
+}
+
+// sendPacket writes the current packet to the socket.
+func (reporter *StatsdReporter) sendPacket() (err error) {
+	if reporter.packet.Len() == 0 {
+		return
+	}
+
+	defer reporter.packet.Reset()
+
+	_, err = reporter.conn.Write(reporter.packet.Bytes())
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored sending metrics to statsd.")
+		return
+	}
+
+	return
+}
+
+// format renders a stat as a StatsD gauge line.
+func (reporter *StatsdReporter) format(stat Stat) string {
+	var name = statsdSanitize(stat.Name)
+	if reporter.cfg.Prefix != "" {
+		name = reporter.cfg.Prefix + "." + name
+	}
+
+	if !reporter.cfg.Tags {
+		for _, key := range sortedKeys(stat.ExtraDimensions) {
+			name += "." + statsdSanitize(stat.ExtraDimensions[key])
+		}
+	}
+
+	var line = name + ":" +
+		strconv.FormatFloat(stat.Value, 'f', -1, 64) + "|g"
+
+	if reporter.cfg.Tags {
+		var (
+			dimensions = mergeDimensions(reporter.dimensions, stat.ExtraDimensions)
+			tags       = make([]string, 0, len(dimensions))
+		)
+
+		for _, key := range sortedKeys(dimensions) {
+			tags = append(tags,
+				statsdSanitizeTag(key)+":"+statsdSanitizeTag(dimensions[key]))
+		}
+
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+	}
+
+	return line
+}
+
+// sortedKeys retrieves the keys of a map in alphabetical
+// order.
+func sortedKeys(m map[string]string) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return
+}
+
+// statsdSanitize replaces the characters that have a meaning
+// in the StatsD protocol (or that would break a metric path)
+// by underscores.
+func statsdSanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', '\n', ' ', '/', '.':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// statsdSanitizePrefix sanitizes each of the dot-separated
+// segments of a prefix.
+func statsdSanitizePrefix(prefix string) string {
+	var segments = strings.Split(prefix, ".")
+	for idx, segment := range segments {
+		segments[idx] = statsdSanitize(segment)
+	}
+
+	return strings.Join(segments, ".")
+}
+
+// statsdSanitizeTag replaces the characters that can't be
+// part of a DogStatsD tag by underscores.
+func statsdSanitizeTag(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdReporterFormat(t *testing.T) {
+	var stat = Stat{
+		Name:  "DiskUtilization",
+		Unit:  "Percent",
+		Value: 12.5,
+		When:  time.Now(),
+		ExtraDimensions: map[string]string{
+			"Path": "/var/lib",
+		},
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		cfg      StatsdReporterConfig
+		expected string
+	}{
+		{
+			desc:     "prefix and dimensions in the name",
+			cfg:      StatsdReporterConfig{Prefix: "prod.awsmon"},
+			expected: "prod.awsmon.DiskUtilization._var_lib:12.5|g",
+		},
+		{
+			desc:     "prefix with special characters",
+			cfg:      StatsdReporterConfig{Prefix: "a:b|c.d#e"},
+			expected: "a_b_c.d_e.DiskUtilization._var_lib:12.5|g",
+		},
+		{
+			desc: "tags",
+			cfg: StatsdReporterConfig{
+				InstanceDimensions: InstanceDimensions{InstanceId: "i-1"},
+				Tags:               true,
+			},
+			expected: "DiskUtilization:12.5|g|#InstanceId:i-1,Path:/var/lib",
+		},
+	} {
+		// dialing udp doesn't need anything to listen.
+		tc.cfg.Address = "127.0.0.1:8125"
+
+		reporter, err := NewStatsdReporter(tc.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reporter.Close()
+
+		if line := reporter.format(stat); line != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.desc, tc.expected, line)
+		}
+	}
+}
+
+func TestStatsdReporterCoalescesPackets(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// room for three 12 bytes gauges (`LoadAvg1:0|g`) and
+	// their separators.
+	const mtu = 40
+
+	reporter, err := NewStatsdReporter(StatsdReporterConfig{
+		Address: conn.LocalAddr().String(),
+		MTU:     mtu,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reporter.Close()
+
+	for i := 0; i < 7; i++ {
+		if err := reporter.SendStat(Stat{Name: "LoadAvg1", Value: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := reporter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		buf     = make([]byte, 1024)
+		packets []int
+	)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for gauges := 0; gauges < 7; {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n > mtu {
+			t.Errorf("expected packets of at most %d bytes, got %d", mtu, n)
+		}
+
+		var lines = strings.Split(string(buf[:n]), "\n")
+		packets = append(packets, len(lines))
+		gauges += len(lines)
+	}
+
+	if !reflect.DeepEqual(packets, []int{3, 3, 1}) {
+		t.Fatalf("expected gauges to be coalesced into packets of 3, got %v", packets)
+	}
+}
@@ -22,3 +22,15 @@ func (r *StdoutReporter) SendStat(stat Stat) (err error) {
 		Msg("sending stat")
 	return
 }
+
+// Flush is a no-op given that stats are logged
+// as soon as they're sent.
+func (r *StdoutReporter) Flush() (err error) {
+	return
+}
+
+// Close is a no-op as there are no resources to
+// release.
+func (r *StdoutReporter) Close() (err error) {
+	return
+}
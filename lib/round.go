@@ -4,7 +4,13 @@ import (
 	"math"
 )
 
+// Round rounds half away from zero, so that -1.5 becomes -2
+// just like 1.5 becomes 2.
 func Round(f float64) float64 {
+	if f < 0 {
+		return -math.Floor(-f + .5)
+	}
+
 	return math.Floor(f + .5)
 }
 
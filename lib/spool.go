@@ -0,0 +1,291 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const spoolEntrySuffix = ".json"
+
+// SpoolConfig configures a Spool.
+type SpoolConfig struct {
+	// Directory is where entries are persisted.
+	Directory string
+
+	// MaxSize is the maximum number of bytes that the
+	// entries can take. Once exceeded, the oldest entries
+	// are discarded.
+	MaxSize int64
+
+	// MaxAge is the maximum age of a stat (according to
+	// its `When`) for it to be worth replaying.
+	MaxAge time.Duration
+}
+
+// Spool persists stats that couldn't be delivered into a
+// bounded local directory so that they can be replayed
+// later, once delivery works again.
+//
+// Each entry is a json file holding a list of stats, named
+// after the time it has been created so that entries can be
+// replayed in order.
+type Spool struct {
+	cfg    SpoolConfig
+	logger zerolog.Logger
+	mu     sync.Mutex
+}
+
+func NewSpool(cfg SpoolConfig) (spool *Spool, err error) {
+	if cfg.Directory == "" {
+		err = errors.Errorf("a spool directory must be provided")
+		return
+	}
+
+	if cfg.MaxSize <= 0 {
+		err = errors.Errorf("spool max size must be positive")
+		return
+	}
+
+	err = os.MkdirAll(cfg.Directory, 0700)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create spool directory %s", cfg.Directory)
+		return
+	}
+
+	spool = &Spool{
+		cfg: cfg,
+		logger: log.With().
+			Str("from", "spool").
+			Str("directory", cfg.Directory).
+			Logger(),
+	}
+	return
+}
+
+// Push persists a list of stats as a new entry, discarding
+// the oldest entries if the size cap gets exceeded.
+func (s *Spool) Push(stats []Stat) (err error) {
+	if len(stats) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't encode stats to spool")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var name = strconv.FormatInt(time.Now().UnixNano(), 10) + spoolEntrySuffix
+
+	err = s.write(name, data)
+	if err != nil {
+		return
+	}
+
+	s.logger.Debug().
+		Str("entry", name).
+		Int("stats", len(stats)).
+		Msg("stats spooled")
+
+	err = s.enforceMaxSize()
+	return
+}
+
+// Replace rewrites an existing entry with a new list of stats,
+// keeping its place in the spool. The entry is removed if the
+// list is empty.
+func (s *Spool) Replace(entry string, stats []Stat) (err error) {
+	if len(stats) == 0 {
+		err = s.Remove(entry)
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't encode stats to spool")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.write(entry, data)
+	return
+}
+
+// write atomically writes the contents of an entry.
+func (s *Spool) write(name string, data []byte) (err error) {
+	var (
+		path = filepath.Join(s.cfg.Directory, name)
+		tmp  = path + ".tmp"
+	)
+
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't write spool entry %s", tmp)
+		return
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		err = errors.Wrapf(err, "couldn't commit spool entry %s", path)
+		return
+	}
+
+	return
+}
+
+// Entries lists the entries of the spool, oldest first.
+func (s *Spool) Entries() (entries []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos, err := s.entryInfos()
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		entries = append(entries, info.Name())
+	}
+
+	return
+}
+
+// Read retrieves the stats of an entry, leaving out those
+// that are older than the maximum age.
+func (s *Spool) Read(entry string) (stats []Stat, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(filepath.Join(s.cfg.Directory, entry))
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read spool entry %s", entry)
+		return
+	}
+
+	var all []Stat
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't decode spool entry %s", entry)
+		return
+	}
+
+	var oldest = time.Now().Add(-s.cfg.MaxAge)
+	for _, stat := range all {
+		if s.cfg.MaxAge > 0 && stat.When.Before(oldest) {
+			continue
+		}
+
+		stats = append(stats, stat)
+	}
+
+	if dropped := len(all) - len(stats); dropped > 0 {
+		s.logger.Warn().
+			Str("entry", entry).
+			Int("dropped", dropped).
+			Msg("dropping stats too old to be delivered")
+	}
+
+	return
+}
+
+// Remove deletes an entry from the spool.
+func (s *Spool) Remove(entry string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = os.Remove(filepath.Join(s.cfg.Directory, entry))
+	if err != nil && !os.IsNotExist(err) {
+		err = errors.Wrapf(err, "couldn't remove spool entry %s", entry)
+		return
+	}
+
+	err = nil
+	return
+}
+
+// entryInfos lists the spool entries sorted by creation
+// time (oldest first).
+func (s *Spool) entryInfos() (entries []os.FileInfo, err error) {
+	infos, err := ioutil.ReadDir(s.cfg.Directory)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't list spool directory %s", s.cfg.Directory)
+		return
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), spoolEntrySuffix) {
+			continue
+		}
+
+		entries = append(entries, info)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return spoolEntryTimestamp(entries[i].Name()) <
+			spoolEntryTimestamp(entries[j].Name())
+	})
+
+	return
+}
+
+// enforceMaxSize removes the oldest entries until the
+// total size of the spool fits the configured cap.
+func (s *Spool) enforceMaxSize() (err error) {
+	infos, err := s.entryInfos()
+	if err != nil {
+		return
+	}
+
+	var total int64
+	for _, info := range infos {
+		total += info.Size()
+	}
+
+	for _, info := range infos {
+		if total <= s.cfg.MaxSize {
+			break
+		}
+
+		err = os.Remove(filepath.Join(s.cfg.Directory, info.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err,
+				"couldn't evict spool entry %s", info.Name())
+			return
+		}
+
+		total -= info.Size()
+		s.logger.Warn().
+			Str("entry", info.Name()).
+			Int64("max-size", s.cfg.MaxSize).
+			Msg("spool full, evicted oldest entry")
+	}
+
+	err = nil
+	return
+}
+
+// spoolEntryTimestamp extracts the creation time (in
+// nanoseconds) encoded in the name of an entry.
+func spoolEntryTimestamp(name string) int64 {
+	ts, _ := strconv.ParseInt(strings.TrimSuffix(name, spoolEntrySuffix), 10, 64)
+	return ts
+}
@@ -0,0 +1,198 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func spoolStats(names ...string) (stats []Stat) {
+	var now = time.Now().Truncate(time.Second)
+	for _, name := range names {
+		stats = append(stats, Stat{
+			Name:  name,
+			Unit:  "Percent",
+			Value: 1,
+			When:  now,
+		})
+	}
+
+	return
+}
+
+func readSpool(t *testing.T, spool *Spool) (names []string) {
+	entries, err := spool.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		stats, err := spool.Read(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, stat := range stats {
+			names = append(names, stat.Name)
+		}
+	}
+
+	return
+}
+
+func TestSpoolPushAndRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := spool.Push(spoolStats(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := spool.Push(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Fatalf("expected entries in push order, got %v", names)
+	}
+
+	entries, _ := spool.Entries()
+	if err := spool.Remove(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spool.Remove(entries[0]); err != nil {
+		t.Fatalf("removing a missing entry should succeed: %s", err)
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Fatalf("expected oldest entry removed, got %v", names)
+	}
+}
+
+func TestSpoolReadDropsOldStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats = spoolStats("fresh", "old")
+	stats[1].When = time.Now().Add(-2 * time.Hour)
+
+	if err := spool.Push(stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"fresh"}) {
+		t.Fatalf("expected old stats to be dropped, got %v", names)
+	}
+}
+
+func TestSpoolEvictsOldestFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spool.Push(spoolStats("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := spool.Entries()
+	info, err := os.Stat(filepath.Join(dir, entries[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room for two entries of the same size.
+	spool.cfg.MaxSize = 2 * info.Size()
+
+	for _, name := range []string{"b", "c"} {
+		if err := spool.Push(spoolStats(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Fatalf("expected the oldest entry to be evicted, got %v", names)
+	}
+}
+
+func TestSpoolReplaceKeepsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsmon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, err := NewSpool(SpoolConfig{
+		Directory: dir,
+		MaxSize:   1024 * 1024,
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spool.Push(spoolStats("a1", "a2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spool.Push(spoolStats("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := spool.Entries()
+	if err := spool.Replace(entries[0], spoolStats("a2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"a2", "b"}) {
+		t.Fatalf("expected the replaced entry to keep its place, got %v", names)
+	}
+
+	if err := spool.Replace(entries[0], nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := readSpool(t, spool); !reflect.DeepEqual(names, []string{"b"}) {
+		t.Fatalf("expected an entry replaced by nothing to be removed, got %v", names)
+	}
+}
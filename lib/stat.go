@@ -10,6 +10,19 @@ type Stat struct {
 	Value           float64
 	When            time.Time
 	ExtraDimensions map[string]string
+
+	// Statistics summarizes the samples that the stat
+	// aggregates (if any), in which case Value holds
+	// their average.
+	Statistics *StatisticSet
+}
+
+// StatisticSet summarizes several samples of a stat.
+type StatisticSet struct {
+	Minimum     float64
+	Maximum     float64
+	Sum         float64
+	SampleCount float64
 }
 
 // NewMemoryUtilizationStat generates a generic Stat
@@ -25,7 +38,7 @@ func NewMemoryUtilizationStat(sample *MemorySample) Stat {
 }
 
 // NewSwapUtilizationStat generates a generic Stat
-// structure prefilled with information about memory
+// structure prefilled with information about swap
 // utilization
 func NewSwapUtilizationStat(sample *MemorySample) Stat {
 	return Stat{
@@ -36,6 +49,66 @@ func NewSwapUtilizationStat(sample *MemorySample) Stat {
 	}
 }
 
+// NewMemoryTotalStat generates a generic Stat
+// structure prefilled with information about the
+// total memory, in bytes.
+func NewMemoryTotalStat(sample *MemorySample) Stat {
+	return Stat{
+		Name:  "MemoryTotal",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Total,
+	}
+}
+
+// NewMemoryUsedStat generates a generic Stat
+// structure prefilled with information about the
+// memory in use, in bytes.
+func NewMemoryUsedStat(sample *MemorySample) Stat {
+	return Stat{
+		Name:  "MemoryUsed",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Used,
+	}
+}
+
+// NewMemoryAvailableStat generates a generic Stat
+// structure prefilled with information about the
+// memory available for new applications, in bytes.
+func NewMemoryAvailableStat(sample *MemorySample) Stat {
+	return Stat{
+		Name:  "MemoryAvailable",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Available,
+	}
+}
+
+// NewMemoryBuffersStat generates a generic Stat
+// structure prefilled with information about the
+// memory used for buffers, in bytes.
+func NewMemoryBuffersStat(sample *MemorySample) Stat {
+	return Stat{
+		Name:  "MemoryBuffers",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Buffers,
+	}
+}
+
+// NewMemoryCachedStat generates a generic Stat
+// structure prefilled with information about the
+// memory used for the page cache, in bytes.
+func NewMemoryCachedStat(sample *MemorySample) Stat {
+	return Stat{
+		Name:  "MemoryCached",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Cached,
+	}
+}
+
 // NewLoadAvg1Stat generates a generic Stat
 // structure prefilled with information about 1m LoadAvg.
 func NewLoadAvg1Stat(sample *LoadSample) Stat {
@@ -92,6 +165,641 @@ func NewInodesUtilizationStat(sample *DiskSample) Stat {
 		Name:  "InodesUtilization",
 		Unit:  "Percent",
 		When:  sample.When,
-		Value: sample.DiskUtilization,
+		Value: sample.InodesUtilization,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskTotalStat generates a generic Stat
+// structure prefilled with information about the
+// total space of a filesystem, in bytes.
+func NewDiskTotalStat(sample *DiskSample) Stat {
+	return Stat{
+		Name:  "DiskTotal",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Total,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskUsedStat generates a generic Stat
+// structure prefilled with information about the
+// space used in a filesystem, in bytes.
+func NewDiskUsedStat(sample *DiskSample) Stat {
+	return Stat{
+		Name:  "DiskUsed",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Used,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskFreeStat generates a generic Stat
+// structure prefilled with information about the
+// space of a filesystem available to unprivileged
+// users, in bytes.
+func NewDiskFreeStat(sample *DiskSample) Stat {
+	return Stat{
+		Name:  "DiskFree",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.Free,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// cpuDimensions generates the extra dimensions of the
+// stats of a cpu sample, identifying the core for per-core
+// samples.
+func cpuDimensions(sample *CPUSample) map[string]string {
+	if sample.Core == "" {
+		return nil
+	}
+
+	return map[string]string{
+		"Core": sample.Core,
+	}
+}
+
+// NewCPUUtilizationStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time the cpu was busy (neither idle
+// nor waiting for io).
+func NewCPUUtilizationStat(sample *CPUSample) Stat {
+	return Stat{
+		Name:            "CPUUtilization",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           100 - sample.Idle - sample.IOWait,
+		ExtraDimensions: cpuDimensions(sample),
+	}
+}
+
+// NewCPUUserStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time spent in user mode.
+func NewCPUUserStat(sample *CPUSample) Stat {
+	return Stat{
+		Name:            "CPUUser",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.User,
+		ExtraDimensions: cpuDimensions(sample),
+	}
+}
+
+// NewCPUSystemStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time spent in system mode.
+func NewCPUSystemStat(sample *CPUSample) Stat {
+	return Stat{
+		Name:            "CPUSystem",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.System,
+		ExtraDimensions: cpuDimensions(sample),
+	}
+}
+
+// NewCPUIOWaitStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time spent waiting for io.
+func NewCPUIOWaitStat(sample *CPUSample) Stat {
+	return Stat{
+		Name:            "CPUIOWait",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.IOWait,
+		ExtraDimensions: cpuDimensions(sample),
+	}
+}
+
+// NewCPUStealStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time stolen by the hypervisor.
+func NewCPUStealStat(sample *CPUSample) Stat {
+	return Stat{
+		Name:            "CPUSteal",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.Steal,
+		ExtraDimensions: cpuDimensions(sample),
+	}
+}
+
+// NewCPUIdleStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time the cpu was idle.
+func NewCPUIdleStat(sample *CPUSample) Stat {
+	return Stat{
+		Name:            "CPUIdle",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.Idle,
+		ExtraDimensions: cpuDimensions(sample),
+	}
+}
+
+// NewDiskReadBytesStat generates a generic Stat
+// structure prefilled with information about the
+// number of bytes read per second from a disk.
+func NewDiskReadBytesStat(sample *DiskIOSample) Stat {
+	return Stat{
+		Name:  "DiskReadBytes",
+		Unit:  "Bytes/Second",
+		When:  sample.When,
+		Value: sample.ReadBytesPerSecond,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskWriteBytesStat generates a generic Stat
+// structure prefilled with information about the
+// number of bytes written per second to a disk.
+func NewDiskWriteBytesStat(sample *DiskIOSample) Stat {
+	return Stat{
+		Name:  "DiskWriteBytes",
+		Unit:  "Bytes/Second",
+		When:  sample.When,
+		Value: sample.WriteBytesPerSecond,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskReadOpsStat generates a generic Stat
+// structure prefilled with information about the
+// number of read operations per second on a disk.
+func NewDiskReadOpsStat(sample *DiskIOSample) Stat {
+	return Stat{
+		Name:  "DiskReadOps",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.ReadOpsPerSecond,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskWriteOpsStat generates a generic Stat
+// structure prefilled with information about the
+// number of write operations per second on a disk.
+func NewDiskWriteOpsStat(sample *DiskIOSample) Stat {
+	return Stat{
+		Name:  "DiskWriteOps",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.WriteOpsPerSecond,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskQueueDepthStat generates a generic Stat
+// structure prefilled with information about the
+// average number of in-flight operations on a disk.
+func NewDiskQueueDepthStat(sample *DiskIOSample) Stat {
+	return Stat{
+		Name:  "DiskQueueDepth",
+		Unit:  "Count",
+		When:  sample.When,
+		Value: sample.QueueDepth,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewDiskAwaitStat generates a generic Stat
+// structure prefilled with information about the
+// average time taken by operations on a disk.
+func NewDiskAwaitStat(sample *DiskIOSample) Stat {
+	return Stat{
+		Name:  "DiskAwait",
+		Unit:  "Milliseconds",
+		When:  sample.When,
+		Value: sample.Await,
+		ExtraDimensions: map[string]string{
+			"Path": sample.Path,
+		},
+	}
+}
+
+// NewNetworkBytesInStat generates a generic Stat
+// structure prefilled with information about the
+// number of bytes received per second on an interface.
+func NewNetworkBytesInStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkBytesIn",
+		Unit:  "Bytes/Second",
+		When:  sample.When,
+		Value: sample.BytesIn,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkBytesOutStat generates a generic Stat
+// structure prefilled with information about the
+// number of bytes sent per second on an interface.
+func NewNetworkBytesOutStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkBytesOut",
+		Unit:  "Bytes/Second",
+		When:  sample.When,
+		Value: sample.BytesOut,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkPacketsInStat generates a generic Stat
+// structure prefilled with information about the
+// number of packets received per second on an interface.
+func NewNetworkPacketsInStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkPacketsIn",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.PacketsIn,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkPacketsOutStat generates a generic Stat
+// structure prefilled with information about the
+// number of packets sent per second on an interface.
+func NewNetworkPacketsOutStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkPacketsOut",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.PacketsOut,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkErrorsInStat generates a generic Stat
+// structure prefilled with information about the
+// number of receive errors per second on an interface.
+func NewNetworkErrorsInStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkErrorsIn",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.ErrorsIn,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkErrorsOutStat generates a generic Stat
+// structure prefilled with information about the
+// number of transmit errors per second on an interface.
+func NewNetworkErrorsOutStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkErrorsOut",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.ErrorsOut,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkDropsInStat generates a generic Stat
+// structure prefilled with information about the
+// number of received packets dropped per second on an interface.
+func NewNetworkDropsInStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkDropsIn",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.DropsIn,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewNetworkDropsOutStat generates a generic Stat
+// structure prefilled with information about the
+// number of packets dropped on transmit per second on an interface.
+func NewNetworkDropsOutStat(sample *NetworkSample) Stat {
+	return Stat{
+		Name:  "NetworkDropsOut",
+		Unit:  "Count/Second",
+		When:  sample.When,
+		Value: sample.DropsOut,
+		ExtraDimensions: map[string]string{
+			"Interface": sample.Interface,
+		},
+	}
+}
+
+// NewProcessCPUUtilizationStat generates a generic Stat
+// structure prefilled with information about the cpu
+// used by the processes of a given name.
+func NewProcessCPUUtilizationStat(sample *ProcessSample) Stat {
+	return Stat{
+		Name:  "ProcessCPUUtilization",
+		Unit:  "Percent",
+		When:  sample.When,
+		Value: sample.CPU,
+		ExtraDimensions: map[string]string{
+			"Process": sample.Name,
+		},
+	}
+}
+
+// NewProcessMemoryRSSStat generates a generic Stat
+// structure prefilled with information about the
+// resident memory of the processes of a given name.
+func NewProcessMemoryRSSStat(sample *ProcessSample) Stat {
+	return Stat{
+		Name:  "ProcessMemoryRSS",
+		Unit:  "Bytes",
+		When:  sample.When,
+		Value: sample.RSS,
+		ExtraDimensions: map[string]string{
+			"Process": sample.Name,
+		},
+	}
+}
+
+// NewProcessThreadsStat generates a generic Stat
+// structure prefilled with information about the
+// number of threads of the processes of a given name.
+func NewProcessThreadsStat(sample *ProcessSample) Stat {
+	return Stat{
+		Name:  "ProcessThreads",
+		Unit:  "Count",
+		When:  sample.When,
+		Value: sample.Threads,
+		ExtraDimensions: map[string]string{
+			"Process": sample.Name,
+		},
+	}
+}
+
+// NewProcessOpenFilesStat generates a generic Stat
+// structure prefilled with information about the
+// file descriptors open by the processes of a given
+// name.
+func NewProcessOpenFilesStat(sample *ProcessSample) Stat {
+	return Stat{
+		Name:  "ProcessOpenFiles",
+		Unit:  "Count",
+		When:  sample.When,
+		Value: sample.OpenFiles,
+		ExtraDimensions: map[string]string{
+			"Process": sample.Name,
+		},
+	}
+}
+
+// NewProcessCountStat generates a generic Stat
+// structure prefilled with information about the
+// number of running processes that a matcher found.
+func NewProcessCountStat(sample *ProcessCheckSample) Stat {
+	return Stat{
+		Name:  "ProcessCount",
+		Unit:  "Count",
+		When:  sample.When,
+		Value: sample.Count,
+		ExtraDimensions: map[string]string{
+			"Matcher": sample.Matcher,
+		},
+	}
+}
+
+// NewProcessUpStat generates a generic Stat
+// structure prefilled with information about
+// whether a matcher found a running process
+// (1) or not (0).
+func NewProcessUpStat(sample *ProcessCheckSample) Stat {
+	var up float64
+	if sample.Count > 0 {
+		up = 1
+	}
+
+	return Stat{
+		Name:  "ProcessUp",
+		Unit:  "None",
+		When:  sample.When,
+		Value: up,
+		ExtraDimensions: map[string]string{
+			"Matcher": sample.Matcher,
+		},
+	}
+}
+
+// NewSystemdUnitActiveStat generates a generic Stat
+// structure prefilled with information about whether
+// a systemd unit is active (1) or not (0).
+func NewSystemdUnitActiveStat(state *SystemdUnitState) Stat {
+	var active float64
+	if state.Active() {
+		active = 1
+	}
+
+	return Stat{
+		Name:  "SystemdUnitActive",
+		Unit:  "None",
+		When:  state.When,
+		Value: active,
+		ExtraDimensions: map[string]string{
+			"Unit": state.Unit,
+		},
+	}
+}
+
+// NewSystemdUnitFailedStat generates a generic Stat
+// structure prefilled with information about whether
+// a systemd unit has failed (1) or not (0).
+func NewSystemdUnitFailedStat(state *SystemdUnitState) Stat {
+	var failed float64
+	if state.Failed() {
+		failed = 1
+	}
+
+	return Stat{
+		Name:  "SystemdUnitFailed",
+		Unit:  "None",
+		When:  state.When,
+		Value: failed,
+		ExtraDimensions: map[string]string{
+			"Unit": state.Unit,
+		},
+	}
+}
+
+// NewSystemdUnitRestartingStat generates a generic Stat
+// structure prefilled with information about whether
+// a systemd unit is waiting to be restarted (1) or
+// not (0).
+func NewSystemdUnitRestartingStat(state *SystemdUnitState) Stat {
+	var restarting float64
+	if state.Restarting() {
+		restarting = 1
+	}
+
+	return Stat{
+		Name:  "SystemdUnitRestarting",
+		Unit:  "None",
+		When:  state.When,
+		Value: restarting,
+		ExtraDimensions: map[string]string{
+			"Unit": state.Unit,
+		},
+	}
+}
+
+// NewSystemdUnitRestartsStat generates a generic Stat
+// structure prefilled with information about the
+// number of times systemd restarted a unit.
+func NewSystemdUnitRestartsStat(state *SystemdUnitState) Stat {
+	return Stat{
+		Name:  "SystemdUnitRestarts",
+		Unit:  "Count",
+		When:  state.When,
+		Value: float64(state.NRestarts),
+		ExtraDimensions: map[string]string{
+			"Unit": state.Unit,
+		},
+	}
+}
+
+// containerDimensions generates the extra dimensions of
+// the stats of a cgroup sample, identifying the container
+// when reporting several of them.
+func containerDimensions(sample *CgroupSample) map[string]string {
+	if sample.Container == "" {
+		return nil
+	}
+
+	return map[string]string{
+		"Container": sample.Container,
+	}
+}
+
+// NewContainerMemoryUsageStat generates a generic Stat
+// structure prefilled with information about the
+// memory used by a container.
+func NewContainerMemoryUsageStat(sample *CgroupSample) Stat {
+	return Stat{
+		Name:            "ContainerMemoryUsage",
+		Unit:            "Bytes",
+		When:            sample.When,
+		Value:           sample.MemoryUsage,
+		ExtraDimensions: containerDimensions(sample),
+	}
+}
+
+// NewContainerMemoryLimitStat generates a generic Stat
+// structure prefilled with information about the
+// memory limit of a container.
+func NewContainerMemoryLimitStat(sample *CgroupSample) Stat {
+	return Stat{
+		Name:            "ContainerMemoryLimit",
+		Unit:            "Bytes",
+		When:            sample.When,
+		Value:           sample.MemoryLimit,
+		ExtraDimensions: containerDimensions(sample),
+	}
+}
+
+// NewContainerMemoryUtilizationStat generates a generic
+// Stat structure prefilled with information about the
+// percentage of its memory limit a container uses.
+func NewContainerMemoryUtilizationStat(sample *CgroupSample) Stat {
+	return Stat{
+		Name:            "ContainerMemoryUtilization",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.MemoryUtilization,
+		ExtraDimensions: containerDimensions(sample),
+	}
+}
+
+// NewContainerCPUUtilizationStat generates a generic
+// Stat structure prefilled with information about the
+// cpu used by a container.
+func NewContainerCPUUtilizationStat(sample *CgroupSample) Stat {
+	return Stat{
+		Name:            "ContainerCPUUtilization",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.CPU,
+		ExtraDimensions: containerDimensions(sample),
+	}
+}
+
+// NewContainerCPUThrottledStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of periods in which a container had its
+// cpu throttled.
+func NewContainerCPUThrottledStat(sample *CgroupSample) Stat {
+	return Stat{
+		Name:            "ContainerCPUThrottled",
+		Unit:            "Percent",
+		When:            sample.When,
+		Value:           sample.Throttled,
+		ExtraDimensions: containerDimensions(sample),
+	}
+}
+
+// NewPressureSomeStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time in which some tasks were stalled
+// waiting for a resource.
+func NewPressureSomeStat(sample *PressureSample) Stat {
+	return Stat{
+		Name:  "PressureSome",
+		Unit:  "Percent",
+		When:  sample.When,
+		Value: sample.Some,
+		ExtraDimensions: map[string]string{
+			"Resource": sample.Resource,
+		},
+	}
+}
+
+// NewPressureFullStat generates a generic Stat
+// structure prefilled with information about the
+// percentage of time in which all tasks were stalled
+// waiting for a resource.
+func NewPressureFullStat(sample *PressureSample) Stat {
+	return Stat{
+		Name:  "PressureFull",
+		Unit:  "Percent",
+		When:  sample.When,
+		Value: sample.Full,
+		ExtraDimensions: map[string]string{
+			"Resource": sample.Resource,
+		},
 	}
 }
@@ -0,0 +1,192 @@
+package lib
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CommandRunner runs a command returning its standard output.
+// It allows replacing the actual execution of commands (e.g.,
+// with canned output).
+type CommandRunner func(ctx context.Context, name string, args ...string) (output []byte, err error)
+
+// SystemdUnitState holds the state of a systemd unit as
+// reported by `systemctl show`.
+type SystemdUnitState struct {
+	Unit        string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	NRestarts   uint64
+	When        time.Time
+}
+
+// systemdUnitProperties lists the properties retrieved from
+// `systemctl show`. `Id` and `Names` identify the unit that
+// each block of properties belongs to.
+var systemdUnitProperties = []string{
+	"Id", "Names", "LoadState", "ActiveState", "SubState", "NRestarts",
+}
+
+// systemdUnitTypes lists the suffixes of the types of units,
+// without which systemd considers a unit to be a service.
+var systemdUnitTypes = map[string]bool{
+	"service": true, "socket": true, "device": true, "mount": true,
+	"automount": true, "swap": true, "target": true, "path": true,
+	"timer": true, "slice": true, "scope": true,
+}
+
+// runCommand is the CommandRunner that executes commands.
+func runCommand(ctx context.Context, name string, args ...string) (output []byte, err error) {
+	output, err = exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = errors.Errorf("command %s failed: %s (%s)", name, err,
+				strings.TrimSpace(string(exitErr.Stderr)))
+			return
+		}
+
+		err = errors.Wrapf(err, "command %s failed", name)
+		return
+	}
+
+	return
+}
+
+// ReadSystemdUnitStates retrieves the state of the given units
+// with a single `systemctl show` call.
+func ReadSystemdUnitStates(ctx context.Context, run CommandRunner, units []string) (states []SystemdUnitState, err error) {
+	var args = []string{
+		"show", "--no-pager",
+		"--property=" + strings.Join(systemdUnitProperties, ","),
+		"--",
+	}
+
+	output, err := run(ctx, "systemctl", append(args, units...)...)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't retrieve state of systemd units")
+		return
+	}
+
+	states, err = parseSystemctlShow(string(output), units)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't parse state of systemd units")
+		return
+	}
+
+	return
+}
+
+// parseSystemctlShow parses the output of `systemctl show`
+// which contains one block of `Property=value` lines per unit,
+// separated by blank lines.
+//
+// Blocks are matched to the requested units by the names of
+// the units they describe (`Id` and `Names`, the latter
+// covering aliases), so that units left out of the output
+// don't shift the others. Those are reported as `not-found`.
+//
+// `NRestarts` is only reported by services (and recent
+// versions of systemd), being 0 otherwise.
+func parseSystemctlShow(data string, units []string) (states []SystemdUnitState, err error) {
+	var (
+		now    = time.Now()
+		blocks []SystemdUnitState
+		names  = map[string]int{}
+		state  *SystemdUnitState
+	)
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			state = nil
+			continue
+		}
+
+		if state == nil {
+			blocks = append(blocks, SystemdUnitState{
+				When: now,
+			})
+			state = &blocks[len(blocks)-1]
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			err = errors.Errorf("unexpected property line '%s'", line)
+			return
+		}
+
+		switch parts[0] {
+		case "Id":
+			state.Unit = parts[1]
+			names[parts[1]] = len(blocks) - 1
+		case "Names":
+			for _, name := range strings.Fields(parts[1]) {
+				names[name] = len(blocks) - 1
+			}
+		case "LoadState":
+			state.LoadState = parts[1]
+		case "ActiveState":
+			state.ActiveState = parts[1]
+		case "SubState":
+			state.SubState = parts[1]
+		case "NRestarts":
+			state.NRestarts, err = strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				err = errors.Errorf("could not parse restarts '%s': %s", parts[1], err)
+				return
+			}
+		}
+	}
+
+	for _, unit := range units {
+		idx, found := names[systemdUnitName(unit)]
+		if !found {
+			states = append(states, SystemdUnitState{
+				Unit:      unit,
+				LoadState: "not-found",
+				When:      now,
+			})
+			continue
+		}
+
+		var state = blocks[idx]
+		state.Unit = unit
+		states = append(states, state)
+	}
+
+	return
+}
+
+// systemdUnitName completes the name of a unit the way that
+// systemctl does, i.e., with the `.service` suffix if it has
+// no unit type (e.g., `nginx` is `nginx.service`).
+func systemdUnitName(unit string) string {
+	if dot := strings.LastIndex(unit, "."); dot != -1 && systemdUnitTypes[unit[dot+1:]] {
+		return unit
+	}
+
+	return unit + ".service"
+}
+
+// Active indicates whether the unit is running.
+func (s *SystemdUnitState) Active() bool {
+	return s.ActiveState == "active" || s.ActiveState == "reloading"
+}
+
+// Failed indicates whether the unit stopped because of a
+// failure (and is not being restarted).
+func (s *SystemdUnitState) Failed() bool {
+	return s.ActiveState == "failed"
+}
+
+// Restarting indicates whether the unit stopped and is
+// waiting to be restarted automatically.
+func (s *SystemdUnitState) Restarting() bool {
+	return s.SubState == "auto-restart"
+}
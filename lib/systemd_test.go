@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// systemctlOutput is the output of `systemctl show` for
+// `nginx ssh.service cron.service missing.service` with
+// systemd skipping the block of `cron.service` and listing
+// the others out of order.
+const systemctlOutput = `Id=ssh.service
+Names=ssh.service sshd.service
+LoadState=loaded
+ActiveState=activating
+SubState=auto-restart
+NRestarts=3
+
+Id=nginx.service
+Names=nginx.service
+LoadState=loaded
+ActiveState=active
+SubState=running
+NRestarts=0
+
+Id=missing.service
+Names=missing.service
+LoadState=not-found
+ActiveState=inactive
+SubState=dead
+NRestarts=0
+`
+
+func TestSystemdCollector(t *testing.T) {
+	var (
+		units = []string{"nginx", "sshd.service", "cron.service", "missing.service"}
+		args  []string
+	)
+
+	run := func(ctx context.Context, name string, arguments ...string) (output []byte, err error) {
+		args = arguments
+		output = []byte(systemctlOutput)
+		return
+	}
+
+	collector, err := NewSystemdCollector(SystemdCollectorConfig{Units: units}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := collector.Collect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "cron.service, missing.service") {
+		t.Errorf("expected cron.service and missing.service to be reported as missing, got %v", err)
+	}
+
+	if !strings.Contains(strings.Join(args, " "), "--property=Id,Names,") {
+		t.Errorf("expected the id of the units to be requested, got %v", args)
+	}
+
+	var values = map[string]float64{}
+	for _, stat := range stats {
+		values[stat.ExtraDimensions["Unit"]+" "+stat.Name] = stat.Value
+	}
+
+	for key, expected := range map[string]float64{
+		"nginx SystemdUnitActive":               1,
+		"nginx SystemdUnitFailed":               0,
+		"nginx SystemdUnitRestarting":           0,
+		"nginx SystemdUnitRestarts":             0,
+		"sshd.service SystemdUnitActive":        0,
+		"sshd.service SystemdUnitFailed":        0,
+		"sshd.service SystemdUnitRestarting":    1,
+		"sshd.service SystemdUnitRestarts":      3,
+		"cron.service SystemdUnitActive":        0,
+		"cron.service SystemdUnitFailed":        0,
+		"cron.service SystemdUnitRestarting":    0,
+		"cron.service SystemdUnitRestarts":      0,
+		"missing.service SystemdUnitActive":     0,
+		"missing.service SystemdUnitFailed":     0,
+		"missing.service SystemdUnitRestarting": 0,
+		"missing.service SystemdUnitRestarts":   0,
+	} {
+		value, found := values[key]
+		if !found {
+			t.Errorf("missing %s", key)
+			continue
+		}
+
+		if value != expected {
+			t.Errorf("expected %s to be %v, got %v", key, expected, value)
+		}
+	}
+}
+
+func TestParseSystemctlShowFailedUnit(t *testing.T) {
+	states, err := parseSystemctlShow(`Id=backup.timer
+Names=backup.timer
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+`, []string{"backup.timer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 || !states[0].Failed() || states[0].Active() {
+		t.Fatalf("expected backup.timer to be failed, got %+v", states)
+	}
+}
+
+func TestParseSystemctlShowInvalidOutput(t *testing.T) {
+	for _, data := range []string{
+		"Id=nginx.service\nnot a property\n",
+		"Id=nginx.service\nNRestarts=many\n",
+	} {
+		if _, err := parseSystemctlShow(data, []string{"nginx"}); err == nil {
+			t.Errorf("expected an error parsing '%s'", data)
+		}
+	}
+}
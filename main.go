@@ -1,32 +1,52 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/alexflint/go-arg"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	. "github.com/cirocosta/awsmon/lib"
 )
 
+// ReporterSpec describes a reporter to send stats to,
+// configured via the `reporters` setting.
+type ReporterSpec struct {
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+}
+
 // CliArguments groups all the arguments that are
 // passed by the user to `awsmon`.
 type CliArguments struct {
 	Config string `arg:"help:path to awsmon configuration file" json:"-"`
 	Debug  bool   `arg:"help:toggles debugging mode" json:"debug"`
 
-	Disk           []string      `arg:"separate,help:retrieve disk samples from disk locations" json:"disk"`
-	Interval       time.Duration `arg:"help:interval between samples" json:"interval"`
-	Load15M        bool          `arg:"--load-15m,help:retrieve load 15m avgs" json:"load-15m"`
-	Load1M         bool          `arg:"--load-1m,help:retrieve load 1m avgs" json:"load-1m"`
-	Load5M         bool          `arg:"--load-5m,help:retrieve load 5m avgs" json:"load-5m"`
-	Memory         bool          `arg:"help:retrieve memory samples" json:"memory"`
-	RelativizeLoad bool          `arg:"--relativize-load,help:makes loadavg relative to cpu count" json:"relativize-load"`
+	Reporters []ReporterSpec `arg:"-" json:"reporters"`
+
+	Collectors       []string                   `arg:"help:collectors to enable" json:"collectors"`
+	CollectorsConfig map[string]json.RawMessage `arg:"-" json:"collectors-config"`
+
+	Disk            []string      `arg:"separate,help:retrieve disk samples from disk locations" json:"disk"`
+	Interval        time.Duration `arg:"help:interval between samples" json:"interval"`
+	PublishInterval time.Duration `arg:"--publish-interval,help:interval between publications of aggregated samples (defaults to the sampling interval)" json:"publish-interval"`
+	MaxFailures     int           `arg:"--max-consecutive-failures,help:consecutive failures of a collector or reporter after which awsmon stops (0 means never)" json:"max-consecutive-failures"`
+	Load15M         bool          `arg:"--load-15m,help:retrieve load 15m avgs" json:"load-15m"`
+	Load1M          bool          `arg:"--load-1m,help:retrieve load 1m avgs" json:"load-1m"`
+	Load5M          bool          `arg:"--load-5m,help:retrieve load 5m avgs" json:"load-5m"`
+	Memory          bool          `arg:"help:retrieve memory samples" json:"memory"`
+	RelativizeLoad  bool          `arg:"--relativize-load,help:makes loadavg relative to cpu count" json:"relativize-load"`
+
+	Precision       int            `arg:"help:number of decimal places that values are rounded to" json:"precision"`
+	MetricPrecision map[string]int `arg:"-" json:"metric-precision"`
 
 	Aws                 bool   `arg:"help:whether or not to enable AWS support" json:"aws"`
 	AwsAccessKey        string `arg:"--aws-access-key,help:aws access-key with cw putMetric caps" json:"aws-access-key"`
@@ -37,22 +57,40 @@ type CliArguments struct {
 	AwsNamespace        string `arg:"--aws-namespace,help:cloudwatch metric namespace" json:"aws-namespace"`
 	AwsRegion           string `arg:"--aws-region,help:region for sending cloudwatch metrics to" json:"aws-region"`
 	AwsSecretKey        string `arg:"--aws-secret-key,help:aws secret-key with cw putMetric caps" json:"aws-secret-key"`
+
+	AwsSpoolDir             string        `arg:"--aws-spool-dir,help:directory where undelivered metrics are kept for later retries (disabled if empty)" json:"aws-spool-dir"`
+	AwsSpoolMaxSize         int64         `arg:"--aws-spool-max-size,help:maximum size in bytes of the spool of undelivered metrics" json:"aws-spool-max-size"`
+	AwsRetryInitialInterval time.Duration `arg:"--aws-retry-initial-interval,help:delay before retrying a failed delivery" json:"aws-retry-initial-interval"`
+	AwsRetryMaxInterval     time.Duration `arg:"--aws-retry-max-interval,help:maximum delay between retries of failed deliveries" json:"aws-retry-max-interval"`
+
+	AwsHighResolution        bool     `arg:"--aws-high-resolution,help:publish every metric with a 1 second resolution (requires an interval below 1m)" json:"aws-high-resolution"`
+	AwsHighResolutionMetrics []string `arg:"--aws-high-resolution-metrics,help:metrics to publish with a 1 second resolution" json:"aws-high-resolution-metrics"`
+
+	PrometheusAddress string `arg:"--prometheus-address,help:address to serve prometheus metrics on (disabled if empty)" json:"prometheus-address"`
+	PrometheusPrefix  string `arg:"--prometheus-prefix,help:prefix of the name of the prometheus metrics" json:"prometheus-prefix"`
 }
 
 var (
-	reporter Reporter
-	err      error
-	disks    = []string{}
-	args     = CliArguments{
-		Aws:            false,
-		AwsNamespace:   "System/Linux",
-		Config:         "/etc/awsmon/config.json",
-		Debug:          false,
-		Disk:           []string{"/"},
-		Interval:       30 * time.Second,
-		Load1M:         true,
-		Memory:         true,
-		RelativizeLoad: true,
+	reporter   Reporter
+	err        error
+	collectors []Collector
+	failures   *FailureTracker
+	args       = CliArguments{
+		Aws:                     false,
+		AwsNamespace:            "System/Linux",
+		AwsSpoolMaxSize:         10 * 1024 * 1024,
+		AwsRetryInitialInterval: 30 * time.Second,
+		AwsRetryMaxInterval:     10 * time.Minute,
+		Collectors:              []string{"disk", "load", "memory"},
+		Config:                  "/etc/awsmon/config.json",
+		Debug:                   false,
+		Disk:                    []string{"/"},
+		Interval:                30 * time.Second,
+		Load1M:                  true,
+		Memory:                  true,
+		Precision:               2,
+		PrometheusPrefix:        "awsmon",
+		RelativizeLoad:          true,
 	}
 )
 
@@ -92,95 +130,378 @@ func mustReadConfigFile(args *CliArguments) {
 	logger.Info().Msg("configuration loaded")
 }
 
-func collectAndSendDiskMetrics() (err error) {
-	var (
-		diskSample DiskSample
-		diskPath   string
-	)
+// publishInterval retrieves the interval between two
+// publications of stats to the reporters.
+func publishInterval() time.Duration {
+	if args.PublishInterval == 0 {
+		return args.Interval
+	}
 
-	for _, diskPath = range args.Disk {
-		diskSample, err = TakeDiskSample(diskPath)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("path", diskPath).
-				Msg("failed to take disk sample")
-			return
-		}
+	return args.PublishInterval
+}
 
-		err = reporter.SendStat(NewDiskUtilizationStat(&diskSample))
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msg("failed to send disk stat")
-			return
+// cloudWatchReporterConfig builds the configuration of the
+// CloudWatch reporter out of the `--aws-*` flags.
+func cloudWatchReporterConfig() CloudWatchReporterConfig {
+	return CloudWatchReporterConfig{
+		AccessKey:        args.AwsAccessKey,
+		SecretKey:        args.AwsSecretKey,
+		Debug:            args.Debug,
+		Namespace:        args.AwsNamespace,
+		InstanceId:       args.AwsInstanceId,
+		InstanceType:     args.AwsInstanceType,
+		AutoScalingGroup: args.AwsAutoScalingGroup,
+		Region:           args.AwsRegion,
+		AggregatedOnly:   args.AwsAggregatedOnly,
+
+		SpoolDirectory:       args.AwsSpoolDir,
+		SpoolMaxSize:         args.AwsSpoolMaxSize,
+		RetryInitialInterval: args.AwsRetryInitialInterval,
+		RetryMaxInterval:     args.AwsRetryMaxInterval,
+
+		HighResolution:        args.AwsHighResolution,
+		HighResolutionMetrics: args.AwsHighResolutionMetrics,
+		Interval:              publishInterval(),
+	}
+}
+
+// prometheusReporterConfig builds the configuration of the
+// prometheus reporter out of the `--prometheus-*` flags.
+func prometheusReporterConfig() PrometheusReporterConfig {
+	return PrometheusReporterConfig{
+		Address:    args.PrometheusAddress,
+		Prefix:     args.PrometheusPrefix,
+		StaleAfter: 3 * publishInterval(),
+	}
+}
+
+// instanceDimensions builds the dimensions identifying the
+// instance out of the `--aws-*` flags.
+func instanceDimensions() InstanceDimensions {
+	return InstanceDimensions{
+		InstanceId:       args.AwsInstanceId,
+		InstanceType:     args.AwsInstanceType,
+		AutoScalingGroup: args.AwsAutoScalingGroup,
+	}
+}
+
+// reporterConfig decodes the configuration of a reporter
+// listed under `reporters`.
+//
+// The configuration derived from the flags serves as the
+// default, so that only what differs needs to be specified.
+func reporterConfig(spec ReporterSpec) (cfg interface{}, err error) {
+	switch spec.Type {
+	case "cw":
+		var c = cloudWatchReporterConfig()
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "prometheus":
+		var c = prometheusReporterConfig()
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "statsd":
+		var c = StatsdReporterConfig{
+			InstanceDimensions: instanceDimensions(),
+			Address:            "127.0.0.1:8125",
+			Prefix:             "awsmon",
+			Tags:               true,
+		}
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "influx":
+		var c = InfluxReporterConfig{
+			InstanceDimensions: instanceDimensions(),
+			Timeout:            10 * time.Second,
+		}
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "graphite":
+		var c = GraphiteReporterConfig{
+			InstanceDimensions:   instanceDimensions(),
+			Namespace:            "awsmon",
+			Timeout:              10 * time.Second,
+			RetryInitialInterval: 5 * time.Second,
+			RetryMaxInterval:     5 * time.Minute,
+		}
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "file":
+		var c = FileReporterConfig{
+			InstanceDimensions: instanceDimensions(),
+			Path:               "/var/log/awsmon/stats.json",
+			MaxSize:            100 * 1024 * 1024,
+			MaxBackups:         5,
+		}
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "emf":
+		var c = EMFReporterConfig{
+			AutoScalingGroup: args.AwsAutoScalingGroup,
+			InstanceId:       args.AwsInstanceId,
+			InstanceType:     args.AwsInstanceType,
+			Namespace:        args.AwsNamespace,
+			AggregatedOnly:   args.AwsAggregatedOnly,
+			Output:           "stdout",
+			Address:          "127.0.0.1:25888",
 		}
+		err = decodeReporterConfig(spec.Config, &c)
+		cfg = c
+	case "stdout":
+		cfg = struct{}{}
+	default:
+		err = errors.Errorf("Unknown reporter type %s", spec.Type)
 	}
 
 	return
 }
 
-func collectAndSendLoadMetrics() (err error) {
-	loadSample, err := TakeLoadSample(args.RelativizeLoad)
+// decodeReporterConfig decodes the raw json configuration of a
+// reporter on top of its defaults.
+func decodeReporterConfig(raw json.RawMessage, cfg interface{}) (err error) {
+	if len(raw) == 0 {
+		return
+	}
+
+	err = json.Unmarshal(raw, cfg)
+	return
+}
+
+// createReporter instantiates the reporter(s) that stats
+// are sent to, rounding their values to the configured
+// precision.
+//
+// When the publish interval is longer than the sampling
+// interval, the samples are aggregated into statistic sets
+// before being rounded and reaching the reporter(s).
+func createReporter() (reporter Reporter, err error) {
+	reporter, err = createBaseReporter()
 	if err != nil {
-		log.Error().
-			Err(err).
-			Bool("relativize-load", args.RelativizeLoad).
-			Msg("failed to take load sample")
 		return
 	}
 
-	if args.Load1M {
-		err = reporter.SendStat(NewLoadAvg1Stat(&loadSample))
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msg("failed to report load1m stat")
+	reporter, err = NewPrecisionReporter(reporter, Precision{
+		Default: args.Precision,
+		Metrics: args.MetricPrecision,
+	})
+	if err != nil {
+		return
+	}
+
+	var interval = publishInterval()
+	if interval == args.Interval {
+		return
+	}
+
+	if interval < args.Interval || interval%args.Interval != 0 {
+		err = errors.Errorf(
+			"publish interval (%s) must be a multiple of the sampling interval (%s)",
+			interval, args.Interval)
+		return
+	}
+
+	reporter = NewAggregator(reporter, int(interval/args.Interval))
+	return
+}
+
+// createBaseReporter instantiates the reporter(s) that stats
+// are published to.
+//
+// When `reporters` is set, every stat goes to each of the
+// reporters listed. Otherwise, the reporters are picked from
+// the flags: CloudWatch if `--aws` is set and/or prometheus if
+// `--prometheus-address` is set, or stdout.
+func createBaseReporter() (reporter Reporter, err error) {
+	var specs = args.Reporters
+	if len(specs) == 0 {
+		if args.Aws {
+			specs = append(specs, ReporterSpec{Type: "cw"})
+		}
+
+		if args.PrometheusAddress != "" {
+			specs = append(specs, ReporterSpec{Type: "prometheus"})
+		}
+
+		switch len(specs) {
+		case 0:
+			reporter, err = NewReporter("stdout", struct{}{})
+			return
+		case 1:
+			var cfg interface{}
+
+			cfg, err = reporterConfig(specs[0])
+			if err != nil {
+				return
+			}
+
+			reporter, err = NewReporter(specs[0].Type, cfg)
 			return
 		}
 	}
 
-	if args.Load5M {
-		err = reporter.SendStat(NewLoadAvg5Stat(&loadSample))
+	var sinks = make([]MultiReporterSink, 0, len(specs))
+	for idx, spec := range specs {
+		var (
+			cfg  interface{}
+			sink Reporter
+			name = fmt.Sprintf("%s[%d]", spec.Type, idx)
+		)
+
+		cfg, err = reporterConfig(spec)
 		if err != nil {
-			log.Error().
-				Err(err).
-				Msg("failed to report load5m stat")
+			err = errors.Wrapf(err, "invalid configuration for reporter %s", name)
 			return
 		}
 
+		sink, err = NewReporter(spec.Type, cfg)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to create reporter %s", name)
+			return
+		}
+
+		sinks = append(sinks, MultiReporterSink{
+			Name:     name,
+			Reporter: sink,
+		})
+	}
+
+	reporter, err = NewMultiReporter(sinks, 0)
+	return
+}
+
+// collectorConfig retrieves the raw configuration of the
+// collector named `name`.
+//
+// For the builtin collectors that predate the `collectors-config`
+// setting, the configuration falls back to the one derived from
+// the legacy flags (`--disk`, `--load-1m`, ...).
+func collectorConfig(name string) (cfg json.RawMessage, err error) {
+	cfg, found := args.CollectorsConfig[name]
+	if found {
+		return
+	}
+
+	switch name {
+	case "disk":
+		// only the paths, so that the other options keep
+		// the collector defaults.
+		cfg, err = json.Marshal(map[string][]string{
+			"paths": args.Disk,
+		})
+	case "diskio":
+		cfg, err = json.Marshal(DiskIOCollectorConfig{
+			Paths: args.Disk,
+		})
+	case "load":
+		cfg, err = json.Marshal(LoadCollectorConfig{
+			Relativize: args.RelativizeLoad,
+			Load1M:     args.Load1M,
+			Load5M:     args.Load5M,
+			Load15M:    args.Load15M,
+		})
 	}
 
-	if args.Load15M {
-		err = reporter.SendStat(NewLoadAvg15Stat(&loadSample))
+	return
+}
+
+// mustCreateCollectors instantiates all the collectors
+// enabled via `args.Collectors`.
+//
+// In the case of errors, breaks the whole execution.
+func mustCreateCollectors() (collectors []Collector) {
+	var (
+		collector Collector
+		cfg       json.RawMessage
+		err       error
+	)
+
+	for _, name := range args.Collectors {
+		if name == "memory" && !args.Memory {
+			continue
+		}
+
+		cfg, err = collectorConfig(name)
+		if err == nil {
+			collector, err = NewCollector(name, cfg)
+		}
+
 		if err != nil {
-			log.Error().
+			log.Fatal().
 				Err(err).
-				Msg("failed to report load15m stat")
-			return
+				Str("collector", name).
+				Strs("available", CollectorNames()).
+				Msg("failed to instantiate collector")
+			os.Exit(1)
 		}
+
+		collectors = append(collectors, collector)
 	}
 
 	return
 }
 
-func collectAndSendMemoryMetrics() (err error) {
-	memorySample, err := TakeMemorySample()
-	if err != nil {
-		log.Error().
-			Err(err).
-			Msg("failed to take memory sample")
+// collectAndSend takes a sample from the collector and sends
+// the resulting stats to the reporter, returning the first
+// error of the reporter (if any) as `sendErr`.
+//
+// Failures of the collector are recorded in the failure tracker
+// so that a single failing collector doesn't prevent the others
+// from reporting. An error is only returned if the failures
+// became fatal.
+func collectAndSend(ctx context.Context, collector Collector) (sendErr, err error) {
+	stats, collectErr := collector.Collect(ctx)
+	for _, stat := range stats {
+		err = reporter.SendStat(stat)
+		if err != nil && sendErr == nil {
+			sendErr = err
+		}
+	}
+
+	err = nil
+	if collectErr != nil {
+		err = failures.Failure(collector.Name(), collectErr)
 		return
 	}
 
-	err = reporter.SendStat(NewMemoryUtilizationStat(&memorySample))
-	if err != nil {
-		log.Error().
-			Err(err).
-			Msg("failed to report memory sample")
+	failures.Success(collector.Name())
+	return
+}
+
+// runCycle collects from every collector and flushes the
+// reporter.
+//
+// The reporter gets a single success or failure recorded per
+// cycle, however many of its calls failed, so that the policy
+// counts consecutive cycles. An error is only returned if the
+// failures became fatal.
+func runCycle(ctx context.Context) (err error) {
+	var reportErr error
+
+	for _, collector := range collectors {
+		var sendErr error
+
+		sendErr, err = collectAndSend(ctx, collector)
+		if err != nil {
+			return
+		}
+
+		if reportErr == nil {
+			reportErr = sendErr
+		}
+	}
+
+	err = reporter.Flush()
+	if reportErr == nil {
+		reportErr = err
+	}
+
+	err = nil
+	if reportErr != nil {
+		err = failures.Failure("reporter", reportErr)
 		return
 	}
 
+	failures.Success("reporter")
 	return
 }
 
@@ -205,21 +526,7 @@ func main() {
 	defer ticker.Stop()
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	if args.Aws {
-		reporter, err = NewReporter("cw", CloudWatchReporterConfig{
-			AccessKey:        args.AwsAccessKey,
-			SecretKey:        args.AwsSecretKey,
-			Debug:            args.Debug,
-			Namespace:        args.AwsNamespace,
-			InstanceId:       args.AwsInstanceId,
-			InstanceType:     args.AwsInstanceType,
-			AutoScalingGroup: args.AwsAutoScalingGroup,
-			Region:           args.AwsRegion,
-			AggregatedOnly:   args.AwsAggregatedOnly,
-		})
-	} else {
-		reporter, err = NewReporter("stdout", struct{}{})
-	}
+	reporter, err = createReporter()
 	if err != nil {
 		log.Fatal().
 			Err(err).
@@ -227,23 +534,34 @@ func main() {
 		os.Exit(1)
 	}
 
+	collectors = mustCreateCollectors()
+	failures = NewFailureTracker(FailurePolicy{
+		MaxConsecutiveFailures: args.MaxFailures,
+	})
+
+	var (
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+
 	go func() {
-		for _ = range ticker.C {
-			err = collectAndSendDiskMetrics()
-			if err != nil {
-				errChan <- err
-				return
-			}
+		defer close(done)
 
-			err = collectAndSendLoadMetrics()
-			if err != nil {
-				errChan <- err
+		for {
+			select {
+			case <-stop:
 				return
+			case <-ticker.C:
 			}
 
-			err = collectAndSendMemoryMetrics()
-			if err != nil {
-				errChan <- err
+			ctx, cancel := context.WithTimeout(
+				context.Background(), args.Interval)
+
+			cycleErr := runCycle(ctx)
+			cancel()
+
+			if cycleErr != nil {
+				errChan <- cycleErr
 				return
 			}
 		}
@@ -252,6 +570,19 @@ func main() {
 	log.Info().Msg("starting sampling")
 	select {
 	case <-signalChan:
+		// let an in-flight cycle finish before closing the
+		// reporter it's sending stats to.
+		ticker.Stop()
+		close(stop)
+		<-done
+
+		err = reporter.Close()
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("failed to flush stats on shutdown")
+		}
+
 		log.Info().Msg("awsmon gracefully stopped")
 		return
 	case err = <-errChan: